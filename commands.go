@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+	"github.com/rawfish-dev/angrypros-api/services/audit"
+	"github.com/rawfish-dev/angrypros-api/services/auth"
+	"github.com/rawfish-dev/angrypros-api/services/storage"
+)
+
+const (
+	commandBootstrapAdmin = "bootstrap-admin"
+)
+
+var (
+	errAdminAlreadyExists = errors.New("an admin already exists, use the admin endpoints instead")
+)
+
+// One-off administrative commands run in place of the server, for example
+// `APP_ENVIRONMENT=prod ./angrypros-api bootstrap-admin someone@example.com`
+func runCommand(ctx context.Context, args []string, a auth.AuthService, s storage.StorageService, au audit.AuditService) error {
+	switch args[0] {
+	case commandBootstrapAdmin:
+		if len(args) != 2 {
+			return fmt.Errorf("usage: %s <email address>", commandBootstrapAdmin)
+		}
+		return bootstrapAdmin(ctx, args[1], a, s, au)
+	}
+
+	return fmt.Errorf("unknown command '%s'", args[0])
+}
+
+// Grants the admin role to an existing user, only allowed while there are
+// no admins so it cannot be used to escalate privileges later on
+func bootstrapAdmin(ctx context.Context, emailAddress string, a auth.AuthService, s storage.StorageService, au audit.AuditService) error {
+	adminCount, err := s.CountUsersWithRole(ctx, models.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if adminCount > 0 {
+		return errAdminAlreadyExists
+	}
+
+	user, err := s.GetUserByEmailAddress(ctx, emailAddress)
+	if err != nil {
+		return fmt.Errorf("could not find user with email %s due to %s", emailAddress, err)
+	}
+
+	// Fetched again as lookups by email do not include roles
+	user, err = s.GetUserById(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+
+	roles := []models.Role{models.RoleAdmin}
+	for _, userRole := range user.Roles {
+		if userRole.Role != models.RoleAdmin {
+			roles = append(roles, userRole.Role)
+		}
+	}
+
+	before := user.RoleNames()
+	err = au.Perform(ctx, audit.Entry{
+		Action:     models.AuditActionBootstrapAdmin,
+		TargetType: models.AuditTargetTypeUser,
+		TargetId:   user.Id,
+	}, func(tx storage.StorageService) (interface{}, interface{}, error) {
+		user, err = tx.SetUserRoles(ctx, user.Id, roles)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return before, user.RoleNames(), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = a.SetFirebaseUserRoles(ctx, user.FirebaseUserId, user.RoleNames())
+	if err != nil {
+		return fmt.Errorf("roles saved but could not sync Firebase custom claims due to %s", err)
+	}
+
+	fmt.Printf("granted admin role to user %d (%s)\n", user.Id, user.Username)
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -13,19 +14,78 @@ var (
 )
 
 type AppConfig struct {
-	GoogleConfig             GoogleConfig             `json:"google"`
-	PostgresConfig           PostgresConfig           `json:"postgres"`
-	DigitalOceanSpacesConfig DigitalOceanSpacesConfig `json:"dospaces"`
-	EntryConfig              EntryConfig              `json:"entry"`
-	FeedConfig               FeedConfig               `json:"feed"`
-	UserConfig               UserConfig               `json:"user"`
+	ServerConfig             ServerConfig                 `json:"server"`
+	LoggingConfig            LoggingConfig                `json:"logging"`
+	TracingConfig            TracingConfig                `json:"tracing"`
+	GoogleConfig             GoogleConfig                 `json:"google"`
+	PostgresConfig           PostgresConfig               `json:"postgres"`
+	DigitalOceanSpacesConfig DigitalOceanSpacesConfig     `json:"dospaces"`
+	EntryConfig              EntryConfig                  `json:"entry"`
+	FeedConfig               FeedConfig                   `json:"feed"`
+	UserConfig               UserConfig                   `json:"user"`
+	NotificationConfig       NotificationConfig           `json:"notification"`
+	EmailConfig              EmailConfig                  `json:"email"`
+	DigestConfig             DigestConfig                 `json:"digest"`
+	ModerationConfig         ModerationConfig             `json:"moderation"`
+	ScreeningConfig          ScreeningConfig              `json:"screening"`
+	RateLimitConfig          RateLimitConfig              `json:"rateLimit"`
+	FeatureFlagsConfig       map[string]FeatureFlagConfig `json:"featureFlags"`
+}
+
+// Zero values fall back to the defaults applied when the HTTP server is built
+type ServerConfig struct {
+	Port int `json:"port"`
+	// Internal listener for /metrics, not to be exposed publicly
+	MetricsPort              int `json:"metricsPort"`
+	ReadTimeoutSeconds       int `json:"readTimeoutSeconds"`
+	ReadHeaderTimeoutSeconds int `json:"readHeaderTimeoutSeconds"`
+	WriteTimeoutSeconds      int `json:"writeTimeoutSeconds"`
+	IdleTimeoutSeconds       int `json:"idleTimeoutSeconds"`
+	MaxHeaderBytes           int `json:"maxHeaderBytes"`
+	MaxRequestBodyBytes      int `json:"maxRequestBodyBytes"`
+	ShutdownTimeoutSeconds   int `json:"shutdownTimeoutSeconds"`
+	// How long readiness reports failure before connections start draining,
+	// giving load balancers time to stop routing to this instance
+	ShutdownDelaySeconds int `json:"shutdownDelaySeconds"`
+
+	// Deadline applied to each request's context, overridden per route by
+	// keys of the form "GET /api/notifications" using the route template
+	RequestTimeoutSeconds      int            `json:"requestTimeoutSeconds"`
+	RouteRequestTimeoutSeconds map[string]int `json:"routeRequestTimeoutSeconds"`
+
+	// How often the config file is checked for runtime setting changes,
+	// zero disables reloading
+	SettingsReloadSeconds int `json:"settingsReloadSeconds"`
+
+	// Addresses or CIDR ranges of proxies whose X-Forwarded-For header is
+	// trusted for the client IP, none are trusted when empty
+	TrustedProxies []string `json:"trustedProxies"`
+}
+
+// Level is one of debug, info, warn or error and format is json or text,
+// defaulting to info and json
+type LoggingConfig struct {
+	Level  string `json:"level"`
+	Format string `json:"format"`
+}
+
+// Exporter is none or otlp, with none being the default. Endpoint is the
+// host and port of an OTLP/HTTP collector. SampleRatio is the fraction of
+// new traces sampled between 0 and 1, every trace is sampled when it is not
+// set
+type TracingConfig struct {
+	Exporter    string   `json:"exporter"`
+	Endpoint    string   `json:"endpoint"`
+	Insecure    bool     `json:"insecure"`
+	ServiceName string   `json:"serviceName"`
+	SampleRatio *float64 `json:"sampleRatio"`
 }
 
 type GoogleConfig struct {
 	Type                    string `json:"type"`
 	ProjectId               string `json:"project_id"`
-	PrivateKeyId            string `json:"project_key_id"`
-	PrivateKey              string `json:"private_key"`
+	PrivateKeyId            string `json:"project_key_id" secret:"true"`
+	PrivateKey              string `json:"private_key" secret:"true"`
 	ClientEmail             string `json:"client_email"`
 	ClientId                string `json:"client_id"`
 	AuthUri                 string `json:"auth_uri"`
@@ -36,7 +96,7 @@ type GoogleConfig struct {
 
 type PostgresConfig struct {
 	Username string `json:"username"`
-	Password string `json:"password"`
+	Password string `json:"password" secret:"true"`
 	Host     string `json:"host"`
 	Port     string `json:"port"`
 	Database string `json:"database"`
@@ -45,8 +105,8 @@ type PostgresConfig struct {
 
 type DigitalOceanSpacesConfig struct {
 	Name     string `json:"name"`
-	Key      string `json:"key"`
-	Secret   string `json:"secret"`
+	Key      string `json:"key" secret:"true"`
+	Secret   string `json:"secret" secret:"true"`
 	Endpoint string `json:"endpoint"`
 	Region   string `json:"region"`
 }
@@ -61,14 +121,85 @@ type FeedConfig struct {
 	DefaultPageSize int `json:"defaultPageSize"`
 }
 
+type NotificationConfig struct {
+	DefaultPageSize int `json:"defaultPageSize"`
+	MaximumPageSize int `json:"maximumPageSize"`
+}
+
+type EmailConfig struct {
+	SMTPHost     string `json:"smtpHost"`
+	SMTPPort     string `json:"smtpPort"`
+	SMTPUsername string `json:"smtpUsername"`
+	SMTPPassword string `json:"smtpPassword" secret:"true"`
+	FromAddress  string `json:"fromAddress"`
+}
+
+type DigestConfig struct {
+	DefaultFrequency         string `json:"defaultFrequency"`
+	CheckIntervalMinutes     int    `json:"checkIntervalMinutes"`
+	MaximumNotificationCount int    `json:"maximumNotificationCount"`
+	UnsubscribeBaseUrl       string `json:"unsubscribeBaseUrl"`
+	UnsubscribeSigningKey    string `json:"unsubscribeSigningKey" secret:"true"`
+}
+
+type ModerationConfig struct {
+	AutoHideReportThreshold int `json:"autoHideReportThreshold"`
+	DefaultPageSize         int `json:"defaultPageSize"`
+}
+
+type ScreeningConfig struct {
+	BlockedTerms []string              `json:"blockedTerms"`
+	Rules        []ScreeningRuleConfig `json:"rules"`
+}
+
+// Rule is one of blocked-terms, email-address, phone-number or
+// street-address and action is one of reject, mask or moderate
+type ScreeningRuleConfig struct {
+	Rule   string `json:"rule"`
+	Action string `json:"action"`
+}
+
+// Store is either memory or postgres, limits are keyed by route group or
+// action name such as public, authed or register
+type RateLimitConfig struct {
+	Store  string                         `json:"store"`
+	Limits map[string]RateLimitRuleConfig `json:"limits"`
+}
+
+type RateLimitRuleConfig struct {
+	Burst             int     `json:"burst"`
+	RequestsPerMinute float64 `json:"requestsPerMinute"`
+}
+
+// A flag is on for a user when it is enabled and any of its rules match, the
+// percentage is a stable bucket of the user id so raising it only ever adds
+// users. Countries are ISO alpha-2 codes and roles are names such as admin
+type FeatureFlagConfig struct {
+	Enabled    bool     `json:"enabled"`
+	Percentage int      `json:"percentage"`
+	Countries  []string `json:"countries"`
+	Roles      []string `json:"roles"`
+	UserIds    []int64  `json:"userIds"`
+}
+
 type UserConfig struct {
 	PasswordMinimumLength int    `json:"passwordMinimumLength"`
 	UsernameMinimumLength int    `json:"usernameMinimumLength"`
 	UsernameMaximumLength int    `json:"usernameMaximumLength"`
 	UsernameRegex         string `json:"usernameRegex"`
+	SearchResultLimit     int    `json:"searchResultLimit"`
+	SearchCacheSeconds    int    `json:"searchCacheSeconds"`
+
+	// Accounts younger than NewAccountDays are subject to new-account rate
+	// limits and spam checks, zero disables these restrictions
+	NewAccountDays                int `json:"newAccountDays"`
+	NewAccountLinkDays            int `json:"newAccountLinkDays"`
+	DuplicateContentWindowMinutes int `json:"duplicateContentWindowMinutes"`
+	VelocityWindowMinutes         int `json:"velocityWindowMinutes"`
+	VelocityMaxSubmissions        int `json:"velocityMaxSubmissions"`
 }
 
-func NewAppConfig(env, directoryPrefix string) AppConfig {
+func NewAppConfig(env, directoryPrefix string) (AppConfig, error) {
 	validEnvironment := false
 	for _, knownEnvironment := range knownEnvironments {
 		if env == knownEnvironment {
@@ -77,31 +208,51 @@ func NewAppConfig(env, directoryPrefix string) AppConfig {
 		}
 	}
 	if !validEnvironment {
-		panic(fmt.Sprintf("'%s' is not a known environment!", env))
+		return AppConfig{}, fmt.Errorf("'%s' is not a known environment", env)
 	}
 
-	configFilePath := fmt.Sprintf("%s/config/app-%s.json", directoryPrefix, env)
-	fullConfigFilePath, err := filepath.Abs(configFilePath)
+	fullConfigFilePath, err := FilePath(env, directoryPrefix)
 	if err != nil {
-		panic(fmt.Sprintf("Unable to load %s file due to %s", configFilePath, err))
+		return AppConfig{}, err
+	}
+
+	// The file is optional so deployments can supply everything through
+	// environment variables instead
+	var appConfig AppConfig
+	configData, err := ioutil.ReadFile(fullConfigFilePath)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return AppConfig{}, fmt.Errorf("unable to read config file at %s due to %s", fullConfigFilePath, err)
+	default:
+		// Unknown keys are rejected so a misspelt field is not silently ignored
+		decoder := json.NewDecoder(bytes.NewReader(configData))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&appConfig)
+		if err != nil {
+			return AppConfig{}, fmt.Errorf("unable to unmarshal config file at %s due to %s", fullConfigFilePath, err)
+		}
 	}
 
-	configFile, err := os.Open(fullConfigFilePath)
+	err = applyEnvOverrides(&appConfig)
 	if err != nil {
-		panic(fmt.Sprintf("unable to open config file at %s due to %s", fullConfigFilePath, err))
+		return AppConfig{}, err
 	}
-	defer configFile.Close()
 
-	configData, err := ioutil.ReadAll(configFile)
+	err = appConfig.Validate()
 	if err != nil {
-		panic(fmt.Sprintf("unable to read config file at %s due to %s", fullConfigFilePath, err))
+		return AppConfig{}, err
 	}
 
-	var appConfig AppConfig
-	err = json.Unmarshal(configData, &appConfig)
+	return appConfig, nil
+}
+
+func FilePath(env, directoryPrefix string) (string, error) {
+	configFilePath := fmt.Sprintf("%s/config/app-%s.json", directoryPrefix, env)
+	fullConfigFilePath, err := filepath.Abs(configFilePath)
 	if err != nil {
-		panic(fmt.Sprintf("unable to unmarshal config file at %s due to %s", fullConfigFilePath, err))
+		return "", fmt.Errorf("unable to load %s file due to %s", configFilePath, err)
 	}
 
-	return appConfig
+	return fullConfigFilePath, nil
 }
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Every field can be overridden by an environment variable named after its
+// JSON path, upper cased with camel case split by underscores and prefixed
+// with APP, so postgres.password becomes APP_POSTGRES_PASSWORD and
+// rateLimit.limits becomes APP_RATE_LIMIT_LIMITS. Appending _FILE reads the
+// value from the named file instead, which suits mounted secrets. Lists and
+// maps take their JSON encoding as the value
+const envPrefix = "APP"
+
+const (
+	envFileSuffix = "_FILE"
+	redactedValue = "[redacted]"
+)
+
+func applyEnvOverrides(appConfig *AppConfig) error {
+	return walkFields(reflect.ValueOf(appConfig).Elem(), envPrefix, func(field reflect.Value, name string) error {
+		value, found, err := lookupEnv(name)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return nil
+		}
+
+		err = setField(field, value)
+		if err != nil {
+			return fmt.Errorf("unable to apply %s due to %s", name, err)
+		}
+
+		return nil
+	})
+}
+
+// Redacted returns the effective config keyed by JSON name with secret
+// fields masked, suitable for logging at startup
+func (a AppConfig) Redacted() map[string]interface{} {
+	return redactStruct(reflect.ValueOf(a))
+}
+
+func redactStruct(v reflect.Value) map[string]interface{} {
+	dump := make(map[string]interface{}, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		structField := v.Type().Field(i)
+		jsonName := jsonFieldName(structField)
+		if jsonName == "" {
+			continue
+		}
+
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Struct:
+			dump[jsonName] = redactStruct(field)
+		case isSecret(structField) && !field.IsZero():
+			dump[jsonName] = redactedValue
+		case field.Kind() == reflect.Ptr && !field.IsNil():
+			dump[jsonName] = field.Elem().Interface()
+		default:
+			dump[jsonName] = field.Interface()
+		}
+	}
+
+	return dump
+}
+
+func walkFields(v reflect.Value, prefix string, fn func(field reflect.Value, name string) error) error {
+	for i := 0; i < v.NumField(); i++ {
+		structField := v.Type().Field(i)
+		jsonName := jsonFieldName(structField)
+		if jsonName == "" {
+			continue
+		}
+
+		name := prefix + "_" + envName(jsonName)
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			err := walkFields(field, name, fn)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := fn(field, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func lookupEnv(name string) (string, bool, error) {
+	value, found := os.LookupEnv(name)
+	filePath, fileFound := os.LookupEnv(name + envFileSuffix)
+	if found && fileFound {
+		return "", false, fmt.Errorf("only one of %s and %s%s may be set", name, name, envFileSuffix)
+	}
+	if !fileFound {
+		return value, found, nil
+	}
+
+	fileData, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", false, fmt.Errorf("unable to read %s%s file at %s due to %s", name, envFileSuffix, filePath, err)
+	}
+
+	// Mounted secrets and files written by editors usually end with a newline
+	return strings.TrimRight(string(fileData), "\r\n"), true, nil
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("'%s' is not an integer", value)
+		}
+		field.SetInt(int64(parsed))
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a number", value)
+		}
+		field.SetFloat(parsed)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a boolean", value)
+		}
+		field.SetBool(parsed)
+	case reflect.Ptr:
+		// Optional values, where the zero value is meaningful when set
+		elem := reflect.New(field.Type().Elem())
+		err := setField(elem.Elem(), value)
+		if err != nil {
+			return err
+		}
+		field.Set(elem)
+	case reflect.Slice, reflect.Map:
+		decoded := reflect.New(field.Type())
+		decoder := json.NewDecoder(strings.NewReader(value))
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(decoded.Interface())
+		if err != nil {
+			return fmt.Errorf("value is not valid JSON for %s due to %s", field.Type(), err)
+		}
+		field.Set(decoded.Elem())
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+
+	return nil
+}
+
+func jsonFieldName(structField reflect.StructField) string {
+	name := strings.Split(structField.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+
+	return name
+}
+
+func isSecret(structField reflect.StructField) bool {
+	return structField.Tag.Get("secret") == "true"
+}
+
+// envName turns a JSON name such as smtpHost or client_x509_cert_url into
+// SMTP_HOST or CLIENT_X509_CERT_URL
+func envName(jsonName string) string {
+	var builder strings.Builder
+	runes := []rune(jsonName)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])) {
+			builder.WriteRune('_')
+		}
+		builder.WriteRune(unicode.ToUpper(r))
+	}
+
+	return builder.String()
+}
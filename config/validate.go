@@ -0,0 +1,351 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rawfish-dev/angrypros-api/services/ratelimit/limits"
+)
+
+// Known values are repeated here rather than imported as the services
+// that own them depend on this package
+var (
+	knownLogLevels         = []string{"", "debug", "info", "warn", "error"}
+	knownLogFormats        = []string{"", "json", "text"}
+	knownTracingExporters  = []string{"", "none", "otlp"}
+	knownSSLModes          = []string{"", "disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+	knownDigestFrequencies = []string{"", "none", "daily", "weekly"}
+	knownScreeningRules    = []string{"blocked-terms", "email-address", "phone-number", "street-address"}
+	knownScreeningActions  = []string{"reject", "mask", "moderate"}
+	knownRateLimitStores   = []string{"", "memory", "postgres"}
+	knownRoles             = []string{"admin", "moderator"}
+
+	featureFlagNameRegex = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+	countryCodeRegex     = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// Problems are reported using the JSON path of the offending field
+type ValidationError struct {
+	Problems []string
+}
+
+func (v ValidationError) Error() string {
+	return fmt.Sprintf("config is invalid: %s", strings.Join(v.Problems, "; "))
+}
+
+// Validate checks every section and reports all problems found rather than
+// stopping at the first
+func (a AppConfig) Validate() error {
+	v := &validator{}
+
+	a.ServerConfig.validate(v)
+	a.LoggingConfig.validate(v)
+	a.TracingConfig.validate(v)
+	a.GoogleConfig.validate(v)
+	a.PostgresConfig.validate(v)
+	a.DigitalOceanSpacesConfig.validate(v)
+	a.EntryConfig.validate(v)
+	a.FeedConfig.validate(v)
+	a.UserConfig.validate(v)
+	a.NotificationConfig.validate(v)
+	a.EmailConfig.validate(v)
+	a.DigestConfig.validate(v)
+	a.ModerationConfig.validate(v)
+	a.ScreeningConfig.validate(v)
+	a.RateLimitConfig.validate(v)
+	validateFeatureFlags(v, a.FeatureFlagsConfig)
+
+	if len(v.problems) != 0 {
+		return ValidationError{Problems: v.problems}
+	}
+
+	return nil
+}
+
+func (s ServerConfig) validate(v *validator) {
+	v.port("server.port", s.Port)
+	v.port("server.metricsPort", s.MetricsPort)
+	if s.Port != 0 && s.Port == s.MetricsPort {
+		v.addf("server.metricsPort must differ from server.port")
+	}
+
+	v.nonNegative("server.readTimeoutSeconds", s.ReadTimeoutSeconds)
+	v.nonNegative("server.readHeaderTimeoutSeconds", s.ReadHeaderTimeoutSeconds)
+	v.nonNegative("server.writeTimeoutSeconds", s.WriteTimeoutSeconds)
+	v.nonNegative("server.idleTimeoutSeconds", s.IdleTimeoutSeconds)
+	v.nonNegative("server.maxHeaderBytes", s.MaxHeaderBytes)
+	v.nonNegative("server.maxRequestBodyBytes", s.MaxRequestBodyBytes)
+	v.nonNegative("server.shutdownTimeoutSeconds", s.ShutdownTimeoutSeconds)
+	v.nonNegative("server.shutdownDelaySeconds", s.ShutdownDelaySeconds)
+	v.nonNegative("server.requestTimeoutSeconds", s.RequestTimeoutSeconds)
+	v.nonNegative("server.settingsReloadSeconds", s.SettingsReloadSeconds)
+
+	for route, seconds := range s.RouteRequestTimeoutSeconds {
+		path := fmt.Sprintf("server.routeRequestTimeoutSeconds[%s]", route)
+		parts := strings.Fields(route)
+		if len(parts) != 2 || !strings.HasPrefix(parts[1], "/") {
+			v.addf("%s must be keyed by method and route such as 'GET /api/notifications'", path)
+		}
+		v.positive(path, seconds)
+	}
+
+	for idx, proxy := range s.TrustedProxies {
+		path := fmt.Sprintf("server.trustedProxies[%d]", idx)
+		if net.ParseIP(proxy) == nil {
+			_, _, err := net.ParseCIDR(proxy)
+			if err != nil {
+				v.addf("%s '%s' must be an IP address or CIDR range", path, proxy)
+			}
+		}
+	}
+}
+
+func (l LoggingConfig) validate(v *validator) {
+	v.oneOf("logging.level", strings.ToLower(l.Level), knownLogLevels)
+	v.oneOf("logging.format", strings.ToLower(l.Format), knownLogFormats)
+}
+
+func (t TracingConfig) validate(v *validator) {
+	v.oneOf("tracing.exporter", t.Exporter, knownTracingExporters)
+	if t.Exporter == "otlp" {
+		v.required("tracing.endpoint", t.Endpoint)
+	}
+	if t.SampleRatio != nil && (*t.SampleRatio < 0 || *t.SampleRatio > 1) {
+		v.addf("tracing.sampleRatio must be between 0 and 1")
+	}
+}
+
+func (g GoogleConfig) validate(v *validator) {
+	if g.Type != "service_account" {
+		v.addf("google.type must be service_account")
+	}
+	v.required("google.project_id", g.ProjectId)
+	v.required("google.private_key", g.PrivateKey)
+	if len(g.PrivateKey) != 0 && !strings.Contains(g.PrivateKey, "PRIVATE KEY") {
+		v.addf("google.private_key must be a PEM encoded private key")
+	}
+	v.email("google.client_email", g.ClientEmail)
+	v.url("google.auth_uri", g.AuthUri)
+	v.url("google.token_uri", g.TokenUri)
+	v.url("google.auth_provider_x509_cert_url", g.AuthProviderX509CertUrl)
+	v.url("google.client_x509_cert_url", g.ClientX509CertUrl)
+}
+
+func (p PostgresConfig) validate(v *validator) {
+	v.required("postgres.username", p.Username)
+	v.required("postgres.host", p.Host)
+	v.required("postgres.database", p.Database)
+	v.numericPort("postgres.port", p.Port)
+	v.oneOf("postgres.sslmode", p.SSLMode, knownSSLModes)
+}
+
+func (d DigitalOceanSpacesConfig) validate(v *validator) {
+	if len(d.Endpoint) != 0 {
+		v.url("dospaces.endpoint", d.Endpoint)
+	}
+	if len(d.Key) != 0 && len(d.Secret) == 0 {
+		v.addf("dospaces.secret is required when dospaces.key is set")
+	}
+}
+
+func (e EntryConfig) validate(v *validator) {
+	v.positive("entry.entryTextContentMaximumLength", e.EntryTextContentMaximumLength)
+	v.nonNegative("entry.initialLoadCommentCount", e.InitialLoadCommentCount)
+	v.nonNegative("entry.subsequentLoadCommentCount", e.SubsequentLoadCommentCount)
+}
+
+func (f FeedConfig) validate(v *validator) {
+	v.positive("feed.defaultPageSize", f.DefaultPageSize)
+}
+
+func (u UserConfig) validate(v *validator) {
+	v.nonNegative("user.passwordMinimumLength", u.PasswordMinimumLength)
+	v.positive("user.usernameMinimumLength", u.UsernameMinimumLength)
+	v.positive("user.usernameMaximumLength", u.UsernameMaximumLength)
+	if u.UsernameMinimumLength >= u.UsernameMaximumLength {
+		v.addf("user.usernameMinimumLength must be less than user.usernameMaximumLength")
+	}
+	v.regex("user.usernameRegex", u.UsernameRegex)
+	v.positive("user.searchResultLimit", u.SearchResultLimit)
+	v.nonNegative("user.searchCacheSeconds", u.SearchCacheSeconds)
+
+	v.nonNegative("user.newAccountDays", u.NewAccountDays)
+	v.nonNegative("user.newAccountLinkDays", u.NewAccountLinkDays)
+	v.nonNegative("user.duplicateContentWindowMinutes", u.DuplicateContentWindowMinutes)
+	v.nonNegative("user.velocityWindowMinutes", u.VelocityWindowMinutes)
+	v.nonNegative("user.velocityMaxSubmissions", u.VelocityMaxSubmissions)
+	if (u.VelocityWindowMinutes > 0) != (u.VelocityMaxSubmissions > 0) {
+		v.addf("user.velocityWindowMinutes and user.velocityMaxSubmissions must be set together")
+	}
+}
+
+func (n NotificationConfig) validate(v *validator) {
+	v.positive("notification.defaultPageSize", n.DefaultPageSize)
+	// Zero leaves the page size uncapped
+	v.nonNegative("notification.maximumPageSize", n.MaximumPageSize)
+	if n.MaximumPageSize > 0 && n.DefaultPageSize > n.MaximumPageSize {
+		v.addf("notification.defaultPageSize must not exceed notification.maximumPageSize")
+	}
+}
+
+func (e EmailConfig) validate(v *validator) {
+	v.required("email.smtpHost", e.SMTPHost)
+	v.numericPort("email.smtpPort", e.SMTPPort)
+	v.email("email.fromAddress", e.FromAddress)
+	if len(e.SMTPUsername) != 0 && len(e.SMTPPassword) == 0 {
+		v.addf("email.smtpPassword is required when email.smtpUsername is set")
+	}
+}
+
+func (d DigestConfig) validate(v *validator) {
+	v.oneOf("digest.defaultFrequency", d.DefaultFrequency, knownDigestFrequencies)
+	v.nonNegative("digest.checkIntervalMinutes", d.CheckIntervalMinutes)
+	v.nonNegative("digest.maximumNotificationCount", d.MaximumNotificationCount)
+	// Every digest carries a signed unsubscribe link
+	v.url("digest.unsubscribeBaseUrl", d.UnsubscribeBaseUrl)
+	v.required("digest.unsubscribeSigningKey", d.UnsubscribeSigningKey)
+}
+
+func (m ModerationConfig) validate(v *validator) {
+	v.nonNegative("moderation.autoHideReportThreshold", m.AutoHideReportThreshold)
+	v.positive("moderation.defaultPageSize", m.DefaultPageSize)
+}
+
+func (s ScreeningConfig) validate(v *validator) {
+	for i, rule := range s.Rules {
+		path := fmt.Sprintf("screening.rules[%d]", i)
+		v.oneOf(path+".rule", rule.Rule, knownScreeningRules)
+		v.oneOf(path+".action", rule.Action, knownScreeningActions)
+		if rule.Rule == "blocked-terms" && len(s.BlockedTerms) == 0 {
+			v.addf("%s uses blocked-terms but screening.blockedTerms is empty", path)
+		}
+	}
+}
+
+func (r RateLimitConfig) validate(v *validator) {
+	v.oneOf("rateLimit.store", r.Store, knownRateLimitStores)
+	for name, limit := range r.Limits {
+		path := fmt.Sprintf("rateLimit.limits[%s]", name)
+		v.oneOf(path, strings.TrimSuffix(name, limits.NewAccountSuffix), limits.Known)
+		v.positive(path+".burst", limit.Burst)
+		if limit.RequestsPerMinute <= 0 {
+			v.addf("%s.requestsPerMinute must be positive", path)
+		}
+	}
+}
+
+func validateFeatureFlags(v *validator, flags map[string]FeatureFlagConfig) {
+	for name, flag := range flags {
+		path := fmt.Sprintf("featureFlags[%s]", name)
+		if !featureFlagNameRegex.MatchString(name) {
+			v.addf("%s name must be lower case words separated by hyphens", path)
+		}
+		if flag.Percentage < 0 || flag.Percentage > 100 {
+			v.addf("%s.percentage must be between 0 and 100", path)
+		}
+		for _, country := range flag.Countries {
+			if !countryCodeRegex.MatchString(country) {
+				v.addf("%s.countries '%s' must be an upper case ISO alpha-2 code", path, country)
+			}
+		}
+		for _, role := range flag.Roles {
+			v.oneOf(path+".roles", role, knownRoles)
+		}
+	}
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) addf(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+func (v *validator) required(path, value string) {
+	if len(strings.TrimSpace(value)) == 0 {
+		v.addf("%s is required", path)
+	}
+}
+
+func (v *validator) positive(path string, value int) {
+	if value <= 0 {
+		v.addf("%s must be positive", path)
+	}
+}
+
+func (v *validator) nonNegative(path string, value int) {
+	if value < 0 {
+		v.addf("%s must not be negative", path)
+	}
+}
+
+func (v *validator) port(path string, value int) {
+	if value < 0 || value > 65535 {
+		v.addf("%s must be between 0 and 65535", path)
+	}
+}
+
+func (v *validator) numericPort(path, value string) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port <= 0 || port > 65535 {
+		v.addf("%s must be a port number", path)
+	}
+}
+
+func (v *validator) oneOf(path, value string, allowed []string) {
+	for _, allowedValue := range allowed {
+		if value == allowedValue {
+			return
+		}
+	}
+
+	var named []string
+	for _, allowedValue := range allowed {
+		if len(allowedValue) != 0 {
+			named = append(named, allowedValue)
+		}
+	}
+	v.addf("%s '%s' must be one of %s", path, value, strings.Join(named, ", "))
+}
+
+func (v *validator) regex(path, value string) {
+	if len(value) == 0 {
+		v.addf("%s is required", path)
+		return
+	}
+
+	_, err := regexp.Compile(value)
+	if err != nil {
+		v.addf("%s does not compile due to %s", path, err)
+	}
+}
+
+func (v *validator) url(path, value string) {
+	if len(value) == 0 {
+		v.addf("%s is required", path)
+		return
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Host) == 0 {
+		v.addf("%s must be an absolute http or https url", path)
+	}
+}
+
+func (v *validator) email(path, value string) {
+	if len(value) == 0 {
+		v.addf("%s is required", path)
+		return
+	}
+
+	_, err := mail.ParseAddress(value)
+	if err != nil {
+		v.addf("%s must be an email address", path)
+	}
+}
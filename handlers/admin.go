@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+	"github.com/rawfish-dev/angrypros-api/services/storage"
+)
+
+var (
+	errOwnAdminRoleRemoved  = errors.New("roles cannot remove your own admin role")
+	errLastAdminRoleRemoved = errors.New("roles cannot remove the last admin")
+)
+
+type UserRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+func (u UserRolesRequest) validate() []error {
+	var validationErrors []error
+
+	for idx, requestedRole := range u.Roles {
+		validRole := false
+		for _, role := range models.Roles {
+			if requestedRole == string(role) {
+				validRole = true
+				break
+			}
+		}
+		if !validRole {
+			validationErrors = append(validationErrors, newFieldError(jsonPointer("roles", idx),
+				fmt.Errorf("role '%s' is invalid", requestedRole)))
+		}
+	}
+
+	return validationErrors
+}
+
+type UserRolesResponse struct {
+	UserId int64    `json:"userId"`
+	Roles  []string `json:"roles"`
+}
+
+func (s Server) GetUserRolesHandler(c *gin.Context) {
+	userId, err := strconv.ParseInt(c.Param("userId"), 10, 64)
+	if err != nil {
+		ResourceNotFoundError(c)
+		return
+	}
+
+	user, err := s.storageService.GetUserById(c.Request.Context(), userId)
+	if err != nil {
+		switch err.(type) {
+		case storage.RecordNotFoundError:
+			ResourceNotFoundError(c)
+			return
+		}
+
+		InternalServerError(c, err)
+		return
+	}
+
+	resp := buildUserRolesResponse(*user)
+
+	WrapJSONAPI(c, http.StatusOK, resp, nil, nil)
+}
+
+func (s Server) EditUserRolesHandler(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(*models.User)
+
+	userId, err := strconv.ParseInt(c.Param("userId"), 10, 64)
+	if err != nil {
+		ResourceNotFoundError(c)
+		return
+	}
+
+	var req UserRolesRequest
+	if !s.decodeJSONBody(c, &req) {
+		return
+	}
+
+	validationErrors := req.validate()
+	if validationErrors != nil {
+		UnprocessableRequestError(c, validationErrors)
+		return
+	}
+
+	roles := make([]models.Role, 0, len(req.Roles))
+	seenRoles := make(map[string]bool)
+	for _, role := range req.Roles {
+		if seenRoles[role] {
+			continue
+		}
+		seenRoles[role] = true
+		roles = append(roles, models.Role(role))
+	}
+
+	var user *models.User
+	err = s.auditService.Perform(c.Request.Context(),
+		s.auditEntry(c, models.AuditActionEditUserRoles, models.AuditTargetTypeUser, userId),
+		func(tx storage.StorageService) (interface{}, interface{}, error) {
+			before, err := tx.GetUserById(c.Request.Context(), userId)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			user, err = tx.SetUserRoles(c.Request.Context(), userId, roles)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if before.HasRole(models.RoleAdmin) && !user.HasRole(models.RoleAdmin) {
+				if userId == currentUser.Id {
+					return nil, nil, errOwnAdminRoleRemoved
+				}
+
+				adminCount, err := tx.CountUsersWithRole(c.Request.Context(), models.RoleAdmin)
+				if err != nil {
+					return nil, nil, err
+				}
+				if adminCount == 0 {
+					return nil, nil, errLastAdminRoleRemoved
+				}
+			}
+
+			// Synced last and within the transaction so a failure leaves the
+			// roles in the database matching the claims
+			err = s.authService.SetFirebaseUserRoles(c.Request.Context(), user.FirebaseUserId, user.RoleNames())
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return buildUserRolesResponse(*before), buildUserRolesResponse(*user), nil
+		})
+	if err != nil {
+		if errors.Is(err, errOwnAdminRoleRemoved) || errors.Is(err, errLastAdminRoleRemoved) {
+			UnprocessableRequestError(c, []error{newFieldError("/roles", err)})
+			return
+		}
+
+		switch err.(type) {
+		case storage.RecordNotFoundError:
+			ResourceNotFoundError(c)
+			return
+		}
+
+		InternalServerError(c, err)
+		return
+	}
+
+	resp := buildUserRolesResponse(*user)
+
+	WrapJSONAPI(c, http.StatusOK, resp, nil, nil)
+}
+
+func buildUserRolesResponse(user models.User) UserRolesResponse {
+	return UserRolesResponse{
+		UserId: user.Id,
+		Roles:  user.RoleNames(),
+	}
+}
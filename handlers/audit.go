@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+	"github.com/rawfish-dev/angrypros-api/services/audit"
+	"github.com/rawfish-dev/angrypros-api/services/storage"
+)
+
+type AuditLogEntryResponse struct {
+	Id         int64           `json:"id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"targetType"`
+	TargetId   int64           `json:"targetId"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	RequestId  string          `json:"requestId"`
+	Actor      *UserResponse   `json:"actor"`
+	CreatedAt  time.Time       `json:"createdAt"`
+}
+
+type AuditLogResponse struct {
+	Entries []AuditLogEntryResponse `json:"entries"`
+}
+
+type AuditLogMeta struct {
+	NextCursor *string `json:"nextCursor"`
+}
+
+func (s Server) GetAuditLogHandler(c *gin.Context) {
+	filter, validationErrors := parseAuditLogFilter(c)
+	if validationErrors != nil {
+		UnprocessableRequestError(c, validationErrors)
+		return
+	}
+
+	var cursor *storage.Cursor
+	if encodedCursor := c.Query("cursor"); len(encodedCursor) != 0 {
+		decodedCursor, err := decodeCursor(encodedCursor)
+		if err != nil {
+			UnprocessableRequestError(c, []error{errCursorInvalid})
+			return
+		}
+		cursor = decodedCursor
+	}
+
+	size := s.settingsService.Current().ModerationConfig.DefaultPageSize
+
+	entries, err := s.storageService.GetAuditLogEntries(c.Request.Context(), filter, cursor, size)
+	if err != nil {
+		InternalServerError(c, err)
+		return
+	}
+
+	entryResponses := make([]AuditLogEntryResponse, len(entries))
+	for idx := range entries {
+		entryResponses[idx] = buildAuditLogEntryResponse(entries[idx])
+	}
+
+	var meta AuditLogMeta
+	if len(entries) > 0 && len(entries) >= size {
+		lastEntry := entries[len(entries)-1]
+		nextCursor := encodeCursor(storage.Cursor{
+			Timestamp: lastEntry.CreatedAt,
+			Id:        lastEntry.Id,
+		})
+		meta.NextCursor = &nextCursor
+	}
+
+	resp := AuditLogResponse{
+		Entries: entryResponses,
+	}
+
+	WrapJSONAPI(c, http.StatusOK, resp, nil, meta)
+}
+
+// Builds the audit entry for an action taken by the current user as part
+// of this request
+func (s Server) auditEntry(c *gin.Context, action models.AuditAction,
+	targetType models.AuditTargetType, targetId int64) audit.Entry {
+	return audit.Entry{
+		ActorUserId: requestCurrentUserId(c),
+		Action:      action,
+		TargetType:  targetType,
+		TargetId:    targetId,
+		RequestId:   requestId(c),
+	}
+}
+
+func parseAuditLogFilter(c *gin.Context) (storage.AuditLogFilter, []error) {
+	var filter storage.AuditLogFilter
+	var validationErrors []error
+
+	if actorUserIdParam := c.Query("actorUserId"); len(actorUserIdParam) != 0 {
+		actorUserId, err := strconv.ParseInt(actorUserIdParam, 10, 64)
+		if err != nil {
+			validationErrors = append(validationErrors, errors.New("actor user id is invalid"))
+		} else {
+			filter.ActorUserId = &actorUserId
+		}
+	}
+
+	if targetTypeParam := c.Query("targetType"); len(targetTypeParam) != 0 {
+		targetType := models.AuditTargetType(targetTypeParam)
+		filter.TargetType = &targetType
+	}
+
+	if targetIdParam := c.Query("targetId"); len(targetIdParam) != 0 {
+		targetId, err := strconv.ParseInt(targetIdParam, 10, 64)
+		if err != nil {
+			validationErrors = append(validationErrors, errors.New("target id is invalid"))
+		} else {
+			filter.TargetId = &targetId
+		}
+	}
+
+	if fromParam := c.Query("from"); len(fromParam) != 0 {
+		from, err := time.Parse(time.RFC3339, fromParam)
+		if err != nil {
+			validationErrors = append(validationErrors, errors.New("from must be an RFC 3339 timestamp"))
+		} else {
+			filter.From = &from
+		}
+	}
+
+	if toParam := c.Query("to"); len(toParam) != 0 {
+		to, err := time.Parse(time.RFC3339, toParam)
+		if err != nil {
+			validationErrors = append(validationErrors, errors.New("to must be an RFC 3339 timestamp"))
+		} else {
+			filter.To = &to
+		}
+	}
+
+	return filter, validationErrors
+}
+
+func buildAuditLogEntryResponse(entry models.AuditLogEntry) AuditLogEntryResponse {
+	resp := AuditLogEntryResponse{
+		Id:         entry.Id,
+		Action:     string(entry.Action),
+		TargetType: string(entry.TargetType),
+		TargetId:   entry.TargetId,
+		RequestId:  entry.RequestId,
+		CreatedAt:  entry.CreatedAt,
+	}
+
+	if entry.Before != nil {
+		resp.Before = json.RawMessage(*entry.Before)
+	}
+	if entry.After != nil {
+		resp.After = json.RawMessage(*entry.After)
+	}
+	if entry.Actor != nil {
+		actor := buildMinimalUserResponse(*entry.Actor)
+		resp.Actor = &actor
+	}
+
+	return resp
+}
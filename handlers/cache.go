@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	timeS "github.com/rawfish-dev/angrypros-api/services/time"
+)
+
+const (
+	defaultCacheMaximumEntries = 1000
+)
+
+type cacheEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// Small in-memory cache for hot read paths such as autocomplete, entries
+// are evicted lazily on read or wholesale when the cache fills up
+type ttlCache struct {
+	mu             sync.Mutex
+	entries        map[string]cacheEntry
+	ttl            time.Duration
+	maximumEntries int
+	timeService    timeS.TimeService
+}
+
+func newTTLCache(ttl time.Duration, t timeS.TimeService) *ttlCache {
+	return &ttlCache{
+		entries:        make(map[string]cacheEntry),
+		ttl:            ttl,
+		maximumEntries: defaultCacheMaximumEntries,
+		timeService:    t,
+	}
+}
+
+func (t *ttlCache) get(ctx context.Context, key string) (interface{}, bool) {
+	if t.ttl <= 0 {
+		return nil, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, exists := t.entries[key]
+	if !exists {
+		return nil, false
+	}
+	if !t.timeService.Now(ctx).Before(entry.expiresAt) {
+		delete(t.entries, key)
+		return nil, false
+	}
+
+	return entry.value, true
+}
+
+func (t *ttlCache) set(ctx context.Context, key string, value interface{}) {
+	if t.ttl <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.entries) >= t.maximumEntries {
+		t.entries = make(map[string]cacheEntry)
+	}
+
+	t.entries[key] = cacheEntry{
+		value:     value,
+		expiresAt: t.timeService.Now(ctx).Add(t.ttl),
+	}
+}
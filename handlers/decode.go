@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Request bodies are decoded strictly so mistakes surface to the client
+// rather than being silently ignored. Only JSON is accepted, bodies are
+// capped in size and unknown or mistyped fields are reported with a JSON
+// pointer to the offending field
+
+const (
+	defaultMaxRequestBodyBytes = 1 << 20
+	jsonMediaType              = "application/json"
+	unknownFieldErrorPrefix    = "json: unknown field "
+)
+
+var (
+	errRequestBodyEmpty      = errors.New("request body is empty")
+	errRequestBodyNotSingle  = errors.New("request body must contain a single JSON value")
+	errRequestBodyNotAllowed = errors.New("request body contains a field that is not allowed")
+)
+
+// Validation error tied to a field of the request body, pointer is a JSON
+// pointer such as /preferences/0/type
+type fieldError struct {
+	pointer string
+	err     error
+}
+
+func (f fieldError) Error() string {
+	return f.err.Error()
+}
+
+func (f fieldError) Unwrap() error {
+	return f.err
+}
+
+func newFieldError(pointer string, err error) error {
+	return fieldError{
+		pointer: pointer,
+		err:     err,
+	}
+}
+
+func fieldErrorPointer(err error) (string, bool) {
+	var fieldErr fieldError
+	if !errors.As(err, &fieldErr) {
+		return "", false
+	}
+
+	return fieldErr.pointer, true
+}
+
+// Ties every error to the same field
+func fieldErrors(pointer string, errs []error) []error {
+	wrapped := make([]error, len(errs))
+	for idx, err := range errs {
+		wrapped[idx] = newFieldError(pointer, err)
+	}
+
+	return wrapped
+}
+
+// Builds a JSON pointer from object keys and array indexes
+func jsonPointer(segments ...interface{}) string {
+	var builder strings.Builder
+	for _, segment := range segments {
+		escaped := strings.NewReplacer("~", "~0", "/", "~1").Replace(fmt.Sprint(segment))
+		builder.WriteString("/")
+		builder.WriteString(escaped)
+	}
+
+	return builder.String()
+}
+
+// Writes the error response and returns false when the body cannot be
+// decoded into dst
+func (s Server) decodeJSONBody(c *gin.Context, dst interface{}) bool {
+	mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil || mediaType != jsonMediaType {
+		UnsupportedMediaTypeError(c)
+		return false
+	}
+
+	maxBytes := int64(s.config.ServerConfig.MaxRequestBodyBytes)
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxRequestBodyBytes
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			RequestTooLargeError(c, maxBytesError.Limit)
+			return false
+		}
+
+		MalformedRequestError(c, err)
+		return false
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(dst)
+	if err == nil {
+		_, err = decoder.Token()
+		if err == io.EOF {
+			return true
+		}
+		err = errRequestBodyNotSingle
+	}
+
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case err == io.EOF:
+		MalformedRequestError(c, errRequestBodyEmpty)
+	case errors.As(err, &typeError):
+		pointer := typeErrorPointer(reflect.TypeOf(dst), typeError.Field)
+		UnprocessableRequestError(c, []error{
+			newFieldError(pointer, fmt.Errorf("%s must be %s", typeError.Field, jsonTypeName(typeError.Type))),
+		})
+	case strings.HasPrefix(err.Error(), unknownFieldErrorPrefix):
+		// encoding/json only reports the key, so the body is walked again to
+		// find where it sits
+		var value interface{}
+		_ = json.Unmarshal(body, &value)
+		pointer := unknownFieldPointer(reflect.TypeOf(dst), value, "")
+		if len(pointer) == 0 {
+			UnprocessableRequestError(c, []error{errRequestBodyNotAllowed})
+			return false
+		}
+
+		UnprocessableRequestError(c, []error{
+			newFieldError(pointer, fmt.Errorf("%s is not a known field",
+				strings.TrimPrefix(err.Error(), unknownFieldErrorPrefix))),
+		})
+	default:
+		MalformedRequestError(c, err)
+	}
+
+	return false
+}
+
+// Follows the dotted path reported by encoding/json through structs, slices
+// and maps, stopping early if the path cannot be matched against t
+func typeErrorPointer(t reflect.Type, fieldPath string) string {
+	if len(fieldPath) == 0 {
+		return ""
+	}
+
+	var segments []interface{}
+	for _, name := range strings.Split(fieldPath, ".") {
+		t = indirectType(t)
+
+		switch t.Kind() {
+		case reflect.Struct:
+			field, exists := jsonField(t, name)
+			if !exists {
+				return jsonPointer(segments...)
+			}
+			t = field.Type
+		case reflect.Slice, reflect.Array:
+			if _, err := strconv.Atoi(name); err != nil {
+				return jsonPointer(segments...)
+			}
+			t = t.Elem()
+		case reflect.Map:
+			t = t.Elem()
+		default:
+			return jsonPointer(segments...)
+		}
+
+		segments = append(segments, name)
+	}
+
+	return jsonPointer(segments...)
+}
+
+// Finds the first key in value that has no matching field in t, returning
+// an empty pointer when there is none
+func unknownFieldPointer(t reflect.Type, value interface{}, pointer string) string {
+	t = indirectType(t)
+
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		switch t.Kind() {
+		case reflect.Map:
+			for _, key := range sortedKeys(typedValue) {
+				found := unknownFieldPointer(t.Elem(), typedValue[key], pointer+jsonPointer(key))
+				if len(found) != 0 {
+					return found
+				}
+			}
+		case reflect.Struct:
+			for _, key := range sortedKeys(typedValue) {
+				field, exists := jsonField(t, key)
+				if !exists {
+					return pointer + jsonPointer(key)
+				}
+
+				found := unknownFieldPointer(field.Type, typedValue[key], pointer+jsonPointer(key))
+				if len(found) != 0 {
+					return found
+				}
+			}
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for idx, element := range typedValue {
+				found := unknownFieldPointer(t.Elem(), element, pointer+jsonPointer(idx))
+				if len(found) != 0 {
+					return found
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// Matches keys the way encoding/json does, preferring an exact match and
+// falling back to a case insensitive one, with embedded structs flattened
+func jsonField(t reflect.Type, name string) (reflect.StructField, bool) {
+	var caseInsensitiveMatch *reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldName := strings.Split(field.Tag.Get("json"), ",")[0]
+		if fieldName == "-" {
+			continue
+		}
+
+		if field.Anonymous && len(fieldName) == 0 && indirectType(field.Type).Kind() == reflect.Struct {
+			embeddedField, exists := jsonField(indirectType(field.Type), name)
+			if exists {
+				return embeddedField, true
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if len(fieldName) == 0 {
+			fieldName = field.Name
+		}
+
+		if fieldName == name {
+			return field, true
+		}
+		if caseInsensitiveMatch == nil && strings.EqualFold(fieldName, name) {
+			caseInsensitiveMatch = &field
+		}
+	}
+
+	if caseInsensitiveMatch != nil {
+		return *caseInsensitiveMatch, true
+	}
+
+	return reflect.StructField{}, false
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch indirectType(t).Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	}
+
+	return "a different type"
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Formats the maximum body size for error details
+func formatBytes(n int64) string {
+	if n >= 1<<20 && n%(1<<20) == 0 {
+		return strconv.FormatInt(n>>20, 10) + " MiB"
+	}
+	if n >= 1<<10 && n%(1<<10) == 0 {
+		return strconv.FormatInt(n>>10, 10) + " KiB"
+	}
+
+	return strconv.FormatInt(n, 10) + " bytes"
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+	"github.com/rawfish-dev/angrypros-api/services/storage"
+)
+
+type RegisterDeviceRequest struct {
+	Token    string `json:"token"`
+	Platform string `json:"platform"`
+}
+
+func (r RegisterDeviceRequest) validate() []error {
+	var validationErrors []error
+
+	if len(r.Token) == 0 {
+		validationErrors = append(validationErrors, newFieldError("/token", errors.New("token is required")))
+	}
+
+	validPlatform := false
+	for _, platform := range models.DevicePlatforms {
+		if r.Platform == string(platform) {
+			validPlatform = true
+			break
+		}
+	}
+	if !validPlatform {
+		validationErrors = append(validationErrors, newFieldError("/platform", errors.New("platform is invalid")))
+	}
+
+	return validationErrors
+}
+
+type DeviceResponse struct {
+	Token    string `json:"token"`
+	Platform string `json:"platform"`
+}
+
+func (s Server) RegisterDeviceHandler(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(*models.User)
+
+	var req RegisterDeviceRequest
+	if !s.decodeJSONBody(c, &req) {
+		return
+	}
+
+	validationErrors := req.validate()
+	if validationErrors != nil {
+		UnprocessableRequestError(c, validationErrors)
+		return
+	}
+
+	deviceToken, err := s.storageService.RegisterDeviceToken(c.Request.Context(), currentUser.Id, req.Token,
+		models.DevicePlatform(req.Platform))
+	if err != nil {
+		InternalServerError(c, err)
+		return
+	}
+
+	resp := DeviceResponse{
+		Token:    deviceToken.Token,
+		Platform: string(deviceToken.Platform),
+	}
+
+	WrapJSONAPI(c, http.StatusCreated, resp, nil, nil)
+}
+
+func (s Server) UnregisterDeviceHandler(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(*models.User)
+
+	err := s.storageService.DeleteDeviceToken(c.Request.Context(), currentUser.Id, c.Param("token"))
+	if err != nil {
+		switch err.(type) {
+		case storage.RecordNotFoundError:
+			ResourceNotFoundError(c)
+			return
+		}
+
+		InternalServerError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
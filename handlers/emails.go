@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+	"github.com/rawfish-dev/angrypros-api/services/digest"
+	"github.com/rawfish-dev/angrypros-api/services/storage"
+)
+
+const (
+	htmlMediaType = "text/html"
+)
+
+//go:embed templates/unsubscribe.html
+var templateFS embed.FS
+
+var unsubscribeTemplate = template.Must(template.ParseFS(templateFS, "templates/unsubscribe.html"))
+
+type unsubscribePageData struct {
+	Action       string
+	Unsubscribed bool
+}
+
+type EmailPreferenceRequest struct {
+	DigestFrequency string `json:"digestFrequency"`
+}
+
+func (e EmailPreferenceRequest) validate() []error {
+	for _, digestFrequency := range models.DigestFrequencies {
+		if e.DigestFrequency == string(digestFrequency) {
+			return nil
+		}
+	}
+
+	return []error{newFieldError("/digestFrequency", errors.New("digest frequency is invalid"))}
+}
+
+type EmailPreferenceResponse struct {
+	DigestFrequency string `json:"digestFrequency"`
+}
+
+func (s Server) GetEmailPreferenceHandler(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(*models.User)
+
+	preference, err := s.storageService.GetEmailPreference(c.Request.Context(), currentUser.Id)
+	if err != nil {
+		switch err.(type) {
+		case storage.RecordNotFoundError:
+			resp := EmailPreferenceResponse{
+				DigestFrequency: s.settingsService.Current().DigestConfig.DefaultFrequency,
+			}
+			WrapJSONAPI(c, http.StatusOK, resp, nil, nil)
+			return
+		}
+
+		InternalServerError(c, err)
+		return
+	}
+
+	resp := buildEmailPreferenceResponse(*preference)
+
+	WrapJSONAPI(c, http.StatusOK, resp, nil, nil)
+}
+
+func (s Server) EditEmailPreferenceHandler(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(*models.User)
+
+	var req EmailPreferenceRequest
+	if !s.decodeJSONBody(c, &req) {
+		return
+	}
+
+	validationErrors := req.validate()
+	if validationErrors != nil {
+		UnprocessableRequestError(c, validationErrors)
+		return
+	}
+
+	preference, err := s.storageService.SaveEmailPreference(c.Request.Context(), currentUser.Id,
+		models.DigestFrequency(req.DigestFrequency))
+	if err != nil {
+		InternalServerError(c, err)
+		return
+	}
+
+	resp := buildEmailPreferenceResponse(*preference)
+
+	WrapJSONAPI(c, http.StatusOK, resp, nil, nil)
+}
+
+// Reached from digest emails without being signed in. GET only renders a
+// confirmation as mail scanners and link previews follow links, the
+// preference is changed by POST from that page or by one-click
+// List-Unsubscribe
+func (s Server) UnsubscribeEmailConfirmationHandler(c *gin.Context) {
+	_, valid := s.verifyUnsubscribe(c)
+	if !valid {
+		return
+	}
+
+	s.renderUnsubscribePage(c, false)
+}
+
+func (s Server) UnsubscribeEmailHandler(c *gin.Context) {
+	userId, valid := s.verifyUnsubscribe(c)
+	if !valid {
+		return
+	}
+
+	_, err := s.storageService.SaveEmailPreference(c.Request.Context(), userId, models.DigestFrequencyNone)
+	if err != nil {
+		InternalServerError(c, err)
+		return
+	}
+
+	// Browsers submitting the confirmation page ask for HTML and get a page
+	// back, one-click and API clients get the usual envelope
+	if strings.Contains(c.GetHeader("Accept"), htmlMediaType) {
+		s.renderUnsubscribePage(c, true)
+		return
+	}
+
+	resp := EmailPreferenceResponse{
+		DigestFrequency: string(models.DigestFrequencyNone),
+	}
+
+	WrapJSONAPI(c, http.StatusOK, resp, nil, nil)
+}
+
+// Writes the error response and returns false when the signed link is not
+// valid
+func (s Server) verifyUnsubscribe(c *gin.Context) (int64, bool) {
+	userId, err := strconv.ParseInt(c.Query("userId"), 10, 64)
+	if err != nil {
+		ResourceNotFoundError(c)
+		return 0, false
+	}
+
+	signingKey := s.settingsService.Current().DigestConfig.UnsubscribeSigningKey
+	if !digest.VerifyUnsubscribe(signingKey, userId, c.Query("signature")) {
+		ResourceNotFoundError(c)
+		return 0, false
+	}
+
+	return userId, true
+}
+
+func (s Server) renderUnsubscribePage(c *gin.Context, unsubscribed bool) {
+	var body bytes.Buffer
+	err := unsubscribeTemplate.Execute(&body, unsubscribePageData{
+		Action:       c.Request.URL.RequestURI(),
+		Unsubscribed: unsubscribed,
+	})
+	if err != nil {
+		InternalServerError(c, err)
+		return
+	}
+
+	c.Data(http.StatusOK, htmlMediaType+"; charset=utf-8", body.Bytes())
+}
+
+func buildEmailPreferenceResponse(preference models.EmailPreference) EmailPreferenceResponse {
+	return EmailPreferenceResponse{
+		DigestFrequency: string(preference.DigestFrequency),
+	}
+}
@@ -1,52 +1,152 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/rawfish-dev/angrypros-api/config"
+	"github.com/rawfish-dev/angrypros-api/models"
+	"github.com/rawfish-dev/angrypros-api/services/audit"
 	"github.com/rawfish-dev/angrypros-api/services/auth"
+	"github.com/rawfish-dev/angrypros-api/services/featureflag"
+	"github.com/rawfish-dev/angrypros-api/services/metrics"
+	"github.com/rawfish-dev/angrypros-api/services/notification"
+	"github.com/rawfish-dev/angrypros-api/services/ratelimit"
+	"github.com/rawfish-dev/angrypros-api/services/ratelimit/limits"
+	"github.com/rawfish-dev/angrypros-api/services/screening"
+	"github.com/rawfish-dev/angrypros-api/services/settings"
+	"github.com/rawfish-dev/angrypros-api/services/spam"
 	"github.com/rawfish-dev/angrypros-api/services/storage"
 	timeS "github.com/rawfish-dev/angrypros-api/services/time"
 )
 
 type Server struct {
-	config         config.AppConfig
-	router         *gin.Engine
-	authService    auth.AuthService
-	storageService storage.StorageService
-	timeService    timeS.TimeService
+	// Only for settings applied once at startup, anything that may change
+	// at runtime is read from settingsService
+	config              config.AppConfig
+	settingsService     settings.SettingsService
+	router              *gin.Engine
+	authService         auth.AuthService
+	storageService      storage.StorageService
+	timeService         timeS.TimeService
+	notificationService notification.NotificationService
+	screeningService    screening.ScreeningService
+	auditService        audit.AuditService
+	rateLimiter         ratelimit.RateLimiter
+	spamService         spam.SpamService
+	featureFlagService  featureflag.FeatureFlagService
+	metrics             *metrics.Metrics
+
+	userSearchCache *ttlCache
+	shuttingDown    *int32
+	openAPIDocument *[]byte
 }
 
-func NewServer(config config.AppConfig, a auth.AuthService,
-	s storage.StorageService, t timeS.TimeService) (*Server, error) {
+func NewServer(config config.AppConfig, st settings.SettingsService, a auth.AuthService,
+	s storage.StorageService, t timeS.TimeService,
+	n notification.NotificationService, sc screening.ScreeningService,
+	au audit.AuditService, r ratelimit.RateLimiter, sp spam.SpamService,
+	f featureflag.FeatureFlagService, m *metrics.Metrics) (*Server, error) {
+	router := gin.New()
+
+	// Gin trusts every proxy by default, which would let any client choose
+	// the IP it is rate limited under through X-Forwarded-For
+	err := router.SetTrustedProxies(config.ServerConfig.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies due to %s", err)
+	}
+
 	return &Server{
-		config:         config,
-		router:         gin.Default(),
-		authService:    a,
-		storageService: s,
-		timeService:    t,
+		config:              config,
+		settingsService:     st,
+		router:              router,
+		authService:         a,
+		storageService:      s,
+		timeService:         t,
+		notificationService: n,
+		screeningService:    sc,
+		auditService:        au,
+		rateLimiter:         r,
+		spamService:         sp,
+		featureFlagService:  f,
+		metrics:             m,
+
+		userSearchCache: newTTLCache(
+			time.Duration(config.UserConfig.SearchCacheSeconds)*time.Second, t),
+		shuttingDown:    new(int32),
+		openAPIDocument: new([]byte),
 	}, nil
 }
 
-func (s Server) SetupRoutes() {
+// Fails when the route table and the OpenAPI operations disagree
+func (s Server) SetupRoutes() error {
+	// Registered before recovery so panics are logged and recorded as 500s
+	s.router.Use(requestIdMiddleware())
+	s.router.Use(tracingMiddleware())
+	s.router.Use(metricsMiddleware(s.metrics))
+	s.router.Use(accessLogMiddleware())
 	s.router.Use(RecoverMiddleware())
+	s.router.Use(requestTimeoutMiddleware(s.config.ServerConfig))
 	// s.router.Use(CORSMiddleware()) Might only be needed for browser
 
-	apiPublic := s.router.Group("/api/public", optionalAuthMiddleware(s.authService, s.storageService))
+	// Probes sit outside the API groups so they are never authenticated or
+	// rate limited
+	s.router.GET("/healthz", s.HealthcheckHandler)
+	s.router.GET("/readyz", s.ReadinessHandler)
+
+	apiPublic := s.router.Group("/api/public", optionalAuthMiddleware(s.authService, s.storageService, s.timeService),
+		rateLimitMiddleware(s.rateLimiter, s.spamService, limits.Public))
 	{
 		apiPublic.GET("/healthcheck", s.HealthcheckHandler)
+		apiPublic.GET("/openapi.json", s.OpenAPIHandler)
 		apiPublic.GET("/countries", s.GetCountriesHandler)
+		apiPublic.GET("/users/search", s.SearchUsersHandler)
+		apiPublic.GET("/email/unsubscribe", s.UnsubscribeEmailConfirmationHandler)
+		apiPublic.POST("/email/unsubscribe", s.UnsubscribeEmailHandler)
 		// apiPublic.GET("/feed", s.GetFeedHandler)
 		// apiPublic.POST("/forgot-password", s.ForgotPasswordHandler)
 	}
 
-	apiAuthed := s.router.Group("/api", authMiddleware(s.authService, s.storageService))
+	apiAuthed := s.router.Group("/api", authMiddleware(s.authService, s.storageService, s.timeService),
+		rateLimitMiddleware(s.rateLimiter, s.spamService, limits.Authed))
 	{
 		apiAuthed.GET("/current-user", s.GetCurrentUserHandler)
-		apiAuthed.POST("/users", s.CreateUserHandler)
+		apiAuthed.POST("/users", rateLimitMiddleware(s.rateLimiter, s.spamService, limits.Register), s.CreateUserHandler)
 		apiAuthed.PUT("/users", s.EditUserHandler)
+		apiAuthed.GET("/notifications", s.GetNotificationsHandler)
+		apiAuthed.POST("/notifications/read", s.MarkAllNotificationsReadHandler)
+		apiAuthed.POST("/notifications/:notificationId/read", s.MarkNotificationReadHandler)
+		apiAuthed.GET("/notifications/preferences", s.GetNotificationPreferencesHandler)
+		apiAuthed.PUT("/notifications/preferences", s.EditNotificationPreferencesHandler)
+		apiAuthed.POST("/devices", s.RegisterDeviceHandler)
+		apiAuthed.DELETE("/devices/:token", s.UnregisterDeviceHandler)
+		apiAuthed.GET("/email/preferences", s.GetEmailPreferenceHandler)
+		apiAuthed.PUT("/email/preferences", s.EditEmailPreferenceHandler)
+		apiAuthed.POST("/reports", rateLimitMiddleware(s.rateLimiter, s.spamService, limits.Report), s.CreateReportHandler)
+	}
+
+	apiModeration := s.router.Group("/api/moderation", authMiddleware(s.authService, s.storageService, s.timeService),
+		rateLimitMiddleware(s.rateLimiter, s.spamService, limits.Moderation))
+	{
+		apiModeration.GET("/reports", requirePermission(models.PermissionModerateReports), s.GetReportsHandler)
+		apiModeration.POST("/reports/:reportId/claim", requirePermission(models.PermissionModerateReports), s.ClaimReportHandler)
+		apiModeration.POST("/reports/:reportId/resolve", requirePermission(models.PermissionModerateReports), s.ResolveReportHandler)
+		apiModeration.POST("/reports/:reportId/dismiss", requirePermission(models.PermissionModerateReports), s.DismissReportHandler)
+		apiModeration.PUT("/users/:userId/suspension", requirePermission(models.PermissionModerateUsers), s.SuspendUserHandler)
+		apiModeration.DELETE("/users/:userId/suspension", requirePermission(models.PermissionModerateUsers), s.UnsuspendUserHandler)
+		apiModeration.PUT("/users/:userId/shadowban", requirePermission(models.PermissionModerateUsers), s.ShadowbanUserHandler)
+		apiModeration.DELETE("/users/:userId/shadowban", requirePermission(models.PermissionModerateUsers), s.UnshadowbanUserHandler)
+	}
+
+	apiAdmin := s.router.Group("/api/admin", authMiddleware(s.authService, s.storageService, s.timeService),
+		rateLimitMiddleware(s.rateLimiter, s.spamService, limits.Admin))
+	{
+		apiAdmin.GET("/users/:userId/roles", requirePermission(models.PermissionManageRoles), s.GetUserRolesHandler)
+		apiAdmin.PUT("/users/:userId/roles", requirePermission(models.PermissionManageRoles), s.EditUserRolesHandler)
+		apiAdmin.GET("/audit-log", requirePermission(models.PermissionReadAuditLog), s.GetAuditLogHandler)
 	}
 
 	// s.router.Use(cors.New(cors.Config{
@@ -62,12 +162,16 @@ func (s Server) SetupRoutes() {
 	// }))
 
 	// api.Use(cors.Default())
+
+	openAPIDocument, err := buildOpenAPIDocument(s.router.Routes())
+	if err != nil {
+		return err
+	}
+	*s.openAPIDocument = openAPIDocument
+
+	return nil
 }
 
 func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.router.ServeHTTP(w, r)
 }
-
-func (s Server) HealthcheckHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, nil)
-}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rawfish-dev/angrypros-api/services/auth"
+)
+
+const (
+	healthStatusOk           = "ok"
+	healthStatusDegraded     = "degraded"
+	healthStatusUnavailable  = "unavailable"
+	healthStatusShuttingDown = "shutting-down"
+
+	dependencyDatabase   = "database"
+	dependencyMigrations = "migrations"
+	dependencyAuth       = "auth"
+
+	// Each dependency check gets its own deadline so one slow dependency
+	// cannot hold up the probe indefinitely
+	readinessCheckTimeout = 3 * time.Second
+)
+
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+type DependencyCheckResponse struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+}
+
+type ReadinessResponse struct {
+	Status string                             `json:"status"`
+	Checks map[string]DependencyCheckResponse `json:"checks"`
+}
+
+// Readiness fails from this point on so load balancers stop sending traffic
+// while in-flight requests drain
+func (s Server) MarkShuttingDown() {
+	atomic.StoreInt32(s.shuttingDown, 1)
+}
+
+// Liveness only reports that the process is able to serve requests
+func (s Server) HealthcheckHandler(c *gin.Context) {
+	WrapJSONAPI(c, http.StatusOK, HealthResponse{Status: healthStatusOk}, nil, nil)
+}
+
+func (s Server) ReadinessHandler(c *gin.Context) {
+	if atomic.LoadInt32(s.shuttingDown) == 1 {
+		WrapJSONAPI(c, http.StatusServiceUnavailable, ReadinessResponse{
+			Status: healthStatusShuttingDown,
+			Checks: map[string]DependencyCheckResponse{},
+		}, nil, nil)
+		return
+	}
+
+	dependencyChecks := map[string]func(ctx context.Context) error{
+		dependencyDatabase:   s.storageService.Ping,
+		dependencyMigrations: s.storageService.CheckMigrations,
+		dependencyAuth:       s.authService.CheckKeySet,
+	}
+
+	resp := ReadinessResponse{
+		Status: healthStatusOk,
+		Checks: make(map[string]DependencyCheckResponse),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for dependency, check := range dependencyChecks {
+		wg.Add(1)
+		go func(dependency string, check func(ctx context.Context) error) {
+			defer wg.Done()
+
+			checkResp := s.checkDependency(c, dependency, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			resp.Checks[dependency] = checkResp
+			switch checkResp.Status {
+			case healthStatusUnavailable:
+				resp.Status = healthStatusUnavailable
+			case healthStatusDegraded:
+				if resp.Status == healthStatusOk {
+					resp.Status = healthStatusDegraded
+				}
+			}
+		}(dependency, check)
+	}
+	wg.Wait()
+
+	// Degraded dependencies still allow requests to be served
+	httpStatus := http.StatusOK
+	if resp.Status == healthStatusUnavailable {
+		httpStatus = http.StatusServiceUnavailable
+	}
+
+	WrapJSONAPI(c, httpStatus, resp, nil, nil)
+}
+
+// Failure details are logged rather than returned as the endpoint is public
+func (s Server) checkDependency(c *gin.Context, dependency string, check func(ctx context.Context) error) DependencyCheckResponse {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessCheckTimeout)
+	defer cancel()
+
+	start := s.timeService.Now(ctx)
+	err := check(ctx)
+	latency := s.timeService.Now(ctx).Sub(start)
+
+	checkResp := DependencyCheckResponse{
+		Status:    healthStatusOk,
+		LatencyMs: float64(latency) / float64(time.Millisecond),
+	}
+
+	if err == nil {
+		return checkResp
+	}
+
+	var staleErr auth.KeySetStaleError
+	if errors.As(err, &staleErr) {
+		requestLogger(c).Warn("readiness check degraded", "dependency", dependency, "error", err)
+		checkResp.Status = healthStatusDegraded
+		return checkResp
+	}
+
+	requestLogger(c).Warn("readiness check failed", "dependency", dependency, "error", err)
+	checkResp.Status = healthStatusUnavailable
+
+	return checkResp
+}
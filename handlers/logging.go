@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rawfish-dev/angrypros-api/services/logging"
+)
+
+const (
+	headerKeyRequestId = "X-Request-ID"
+)
+
+var (
+	// Incoming ids are only trusted when they cannot break log lines
+	requestIdRegex = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+)
+
+// Accepts the caller's request id or generates one, echoes it back and
+// attaches it to the request logger so every log line can be correlated
+func requestIdMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.Request.Header.Get(headerKeyRequestId)
+		if !requestIdRegex.MatchString(requestId) {
+			requestId = newRequestId()
+		}
+
+		c.Set("requestId", requestId)
+		c.Header(headerKeyRequestId, requestId)
+		setRequestLogger(c, slog.Default().With("request_id", requestId))
+
+		c.Next()
+	}
+}
+
+// Replaces gin's own text logger
+func accessLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		requestLogger(c).Info("request completed",
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"latency_ms", float64(time.Since(start))/float64(time.Millisecond),
+			"client_ip", c.ClientIP())
+	}
+}
+
+func requestId(c *gin.Context) string {
+	return c.GetString("requestId")
+}
+
+func requestLogger(c *gin.Context) *slog.Logger {
+	return logging.FromContext(c.Request.Context())
+}
+
+func setRequestLogger(c *gin.Context, logger *slog.Logger) {
+	c.Request = c.Request.WithContext(logging.NewContext(c.Request.Context(), logger))
+}
+
+func newRequestId() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		// Uniqueness only matters for correlation so a clock based id is enough
+		return time.Now().UTC().Format("20060102T150405.000000000")
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rawfish-dev/angrypros-api/services/metrics"
+)
+
+// Labels by route template rather than path so ids in the path do not
+// create a series per resource
+func metricsMiddleware(m *metrics.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if len(route) == 0 {
+			route = metrics.RouteUnmatched
+		}
+
+		m.ObserveHTTPRequest(route, c.Request.Method, strconv.Itoa(c.Writer.Status()),
+			time.Since(start).Seconds())
+	}
+}
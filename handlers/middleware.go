@@ -1,15 +1,18 @@
 package handlers
 
 import (
-	"log"
+	"fmt"
 	"net/http"
 	"runtime/debug"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/rawfish-dev/angrypros-api/models"
 	"github.com/rawfish-dev/angrypros-api/services/auth"
 	"github.com/rawfish-dev/angrypros-api/services/storage"
+	timeS "github.com/rawfish-dev/angrypros-api/services/time"
 )
 
 const (
@@ -39,8 +42,9 @@ func RecoverMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		defer func() {
 			if rec := recover(); rec != nil {
-				log.Printf("caught panic due to %s", rec)
-				debug.PrintStack()
+				requestLogger(c).Error("caught panic",
+					"panic", fmt.Sprint(rec),
+					"stack", string(debug.Stack()))
 
 				InternalServerError(c, nil)
 				return
@@ -52,7 +56,7 @@ func RecoverMiddleware() gin.HandlerFunc {
 }
 
 // Should not be used directly but via publicOrAuthedMiddleware or authedOnlyMiddleware
-func optionalAuthMiddleware(a auth.AuthService, s storage.StorageService) gin.HandlerFunc {
+func optionalAuthMiddleware(a auth.AuthService, s storage.StorageService, t timeS.TimeService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Ignore ALL errors and only set currentUser in the event everything succeeds
 
@@ -63,13 +67,15 @@ func optionalAuthMiddleware(a auth.AuthService, s storage.StorageService) gin.Ha
 			if len(tokens) == 2 {
 				idToken := tokens[1]
 
-				firebaseUserId, err := a.GetFirebaseUserId(idToken)
+				firebaseUserId, err := a.GetFirebaseUserId(c.Request.Context(), idToken)
 				if err == nil {
 					c.Set("firebaseUserId", firebaseUserId)
 
-					user, err := s.GetUserByFirebaseUserId(firebaseUserId)
-					if err == nil && user != nil {
+					// Suspended users browse public routes anonymously
+					user, err := s.GetUserByFirebaseUserId(c.Request.Context(), firebaseUserId)
+					if err == nil && user != nil && !user.IsSuspended(t.Now(c.Request.Context())) {
 						c.Set("currentUser", user)
+						setRequestLogger(c, requestLogger(c).With("user_id", user.Id))
 					}
 				}
 			}
@@ -80,7 +86,7 @@ func optionalAuthMiddleware(a auth.AuthService, s storage.StorageService) gin.Ha
 }
 
 // Should not be used directly but via publicOrAuthedMiddleware or authedOnlyMiddleware
-func authMiddleware(a auth.AuthService, s storage.StorageService) gin.HandlerFunc {
+func authMiddleware(a auth.AuthService, s storage.StorageService, t timeS.TimeService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeaderValue := c.Request.Header.Get(headerKeyAuthorization)
 		if len(authHeaderValue) == 0 {
@@ -112,7 +118,7 @@ func authMiddleware(a auth.AuthService, s storage.StorageService) gin.HandlerFun
 
 		var firebaseUserId string
 
-		firebaseUserId, err := a.GetFirebaseUserId(idToken)
+		firebaseUserId, err := a.GetFirebaseUserId(c.Request.Context(), idToken)
 		if err != nil {
 			errors := []ResponseError{
 				{
@@ -126,7 +132,7 @@ func authMiddleware(a auth.AuthService, s storage.StorageService) gin.HandlerFun
 		}
 		c.Set("firebaseUserId", firebaseUserId)
 
-		user, err := s.GetUserByFirebaseUserId(firebaseUserId)
+		user, err := s.GetUserByFirebaseUserId(c.Request.Context(), firebaseUserId)
 		if err != nil {
 			switch err.(type) {
 			case storage.RecordNotFoundError:
@@ -153,12 +159,40 @@ func authMiddleware(a auth.AuthService, s storage.StorageService) gin.HandlerFun
 			}
 		}
 
+		// Suspensions lapse on their own once SuspendedUntil has passed
+		if user != nil && user.IsSuspended(t.Now(c.Request.Context())) {
+			errors := []ResponseError{
+				{
+					Code:  string(AccountSuspended),
+					Title: "Account suspended",
+					Detail: fmt.Sprintf("Account is suspended until %s: %s",
+						user.SuspendedUntil.UTC().Format(time.RFC3339), user.SuspensionReason),
+				},
+			}
+			WrapJSONAPI(c, http.StatusForbidden, nil, errors, nil)
+			return
+		}
+
 		// Setting with user value nil results in complications when
 		// checking against nil later on as the interface value is not
 		// nil, so skipping setting here makes it easy to check for
 		// direct existence
 		if user != nil {
 			c.Set("currentUser", user)
+			setRequestLogger(c, requestLogger(c).With("user_id", user.Id))
+		}
+
+		c.Next()
+	}
+}
+
+// Must be used after authMiddleware as it relies on currentUser being set
+func requirePermission(permission models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		currentUser, exists := c.Get("currentUser")
+		if !exists || !currentUser.(*models.User).HasPermission(permission) {
+			ForbiddenError(c)
+			return
 		}
 
 		c.Next()
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+	"github.com/rawfish-dev/angrypros-api/services/storage"
+)
+
+type SuspendUserRequest struct {
+	Reason         string    `json:"reason"`
+	SuspendedUntil time.Time `json:"suspendedUntil"`
+}
+
+func (s SuspendUserRequest) validate(now time.Time) []error {
+	var validationErrors []error
+
+	if len(s.Reason) == 0 {
+		validationErrors = append(validationErrors, newFieldError("/reason", errors.New("reason is required")))
+	}
+
+	if !s.SuspendedUntil.After(now) {
+		validationErrors = append(validationErrors, newFieldError("/suspendedUntil",
+			errors.New("suspended until must be in the future")))
+	}
+
+	return validationErrors
+}
+
+type ModeratedUserResponse struct {
+	UserResponse
+	SuspendedUntil   *time.Time `json:"suspendedUntil"`
+	SuspensionReason string     `json:"suspensionReason"`
+	Shadowbanned     bool       `json:"shadowbanned"`
+}
+
+// Applies a change to a user through the audit service, the change receives
+// a transaction bound storage service
+type moderateUserFunc func(tx storage.StorageService) (*models.User, error)
+
+func (s Server) SuspendUserHandler(c *gin.Context) {
+	userId, err := strconv.ParseInt(c.Param("userId"), 10, 64)
+	if err != nil {
+		ResourceNotFoundError(c)
+		return
+	}
+
+	var req SuspendUserRequest
+	if !s.decodeJSONBody(c, &req) {
+		return
+	}
+
+	validationErrors := req.validate(s.timeService.Now(c.Request.Context()))
+	if validationErrors != nil {
+		UnprocessableRequestError(c, validationErrors)
+		return
+	}
+
+	if !s.canModerateUser(c, userId) {
+		return
+	}
+
+	s.moderateUser(c, userId, models.AuditActionSuspendUser,
+		func(tx storage.StorageService) (*models.User, error) {
+			return tx.SuspendUser(c.Request.Context(), userId, req.SuspendedUntil, req.Reason)
+		})
+}
+
+func (s Server) UnsuspendUserHandler(c *gin.Context) {
+	userId, err := strconv.ParseInt(c.Param("userId"), 10, 64)
+	if err != nil {
+		ResourceNotFoundError(c)
+		return
+	}
+
+	if !s.canModerateUser(c, userId) {
+		return
+	}
+
+	s.moderateUser(c, userId, models.AuditActionUnsuspendUser,
+		func(tx storage.StorageService) (*models.User, error) {
+			return tx.UnsuspendUser(c.Request.Context(), userId)
+		})
+}
+
+func (s Server) ShadowbanUserHandler(c *gin.Context) {
+	userId, err := strconv.ParseInt(c.Param("userId"), 10, 64)
+	if err != nil {
+		ResourceNotFoundError(c)
+		return
+	}
+
+	if !s.canModerateUser(c, userId) {
+		return
+	}
+
+	s.moderateUser(c, userId, models.AuditActionShadowbanUser,
+		func(tx storage.StorageService) (*models.User, error) {
+			return tx.SetUserShadowbanned(c.Request.Context(), userId, true)
+		})
+}
+
+func (s Server) UnshadowbanUserHandler(c *gin.Context) {
+	userId, err := strconv.ParseInt(c.Param("userId"), 10, 64)
+	if err != nil {
+		ResourceNotFoundError(c)
+		return
+	}
+
+	if !s.canModerateUser(c, userId) {
+		return
+	}
+
+	s.moderateUser(c, userId, models.AuditActionUnshadowbanUser,
+		func(tx storage.StorageService) (*models.User, error) {
+			return tx.SetUserShadowbanned(c.Request.Context(), userId, false)
+		})
+}
+
+// Writes the error response and returns false when the current user may
+// not act against the target
+func (s Server) canModerateUser(c *gin.Context, userId int64) bool {
+	currentUser := c.MustGet("currentUser").(*models.User)
+
+	target, err := s.storageService.GetUserById(c.Request.Context(), userId)
+	if err != nil {
+		switch err.(type) {
+		case storage.RecordNotFoundError:
+			ResourceNotFoundError(c)
+			return false
+		}
+
+		InternalServerError(c, err)
+		return false
+	}
+
+	if !currentUser.CanModerate(*target) {
+		ForbiddenError(c)
+		return false
+	}
+
+	return true
+}
+
+func (s Server) moderateUser(c *gin.Context, userId int64, action models.AuditAction, moderate moderateUserFunc) {
+	var user *models.User
+	err := s.auditService.Perform(c.Request.Context(),
+		s.auditEntry(c, action, models.AuditTargetTypeUser, userId),
+		func(tx storage.StorageService) (interface{}, interface{}, error) {
+			before, err := tx.GetUserById(c.Request.Context(), userId)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			user, err = moderate(tx)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return buildModeratedUserResponse(*before), buildModeratedUserResponse(*user), nil
+		})
+	if err != nil {
+		switch err.(type) {
+		case storage.RecordNotFoundError:
+			ResourceNotFoundError(c)
+			return
+		}
+
+		InternalServerError(c, err)
+		return
+	}
+
+	resp := buildModeratedUserResponse(*user)
+
+	WrapJSONAPI(c, http.StatusOK, resp, nil, nil)
+}
+
+func buildModeratedUserResponse(user models.User) ModeratedUserResponse {
+	return ModeratedUserResponse{
+		UserResponse:     buildMinimalUserResponse(user),
+		SuspendedUntil:   user.SuspendedUntil,
+		SuspensionReason: user.SuspensionReason,
+		Shadowbanned:     user.ShadowbannedAt != nil,
+	}
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+	"github.com/rawfish-dev/angrypros-api/services/storage"
+)
+
+var (
+	errCursorInvalid = errors.New("cursor is invalid")
+)
+
+type NotificationResponse struct {
+	Id          int64        `json:"id"`
+	Type        string       `json:"type"`
+	TargetType  string       `json:"targetType"`
+	TargetId    int64        `json:"targetId"`
+	LatestActor UserResponse `json:"latestActor"`
+	ActorCount  int          `json:"actorCount"`
+	Read        bool         `json:"read"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	UpdatedAt   time.Time    `json:"updatedAt"`
+}
+
+type NotificationsResponse struct {
+	Notifications []NotificationResponse `json:"notifications"`
+}
+
+type NotificationsMeta struct {
+	UnreadCount int64   `json:"unreadCount"`
+	NextCursor  *string `json:"nextCursor"`
+}
+
+type NotificationPreferenceRequest struct {
+	Type        string `json:"type"`
+	PushEnabled bool   `json:"pushEnabled"`
+}
+
+type NotificationPreferencesRequest struct {
+	Preferences []NotificationPreferenceRequest `json:"preferences"`
+}
+
+func (n NotificationPreferencesRequest) validate() []error {
+	var validationErrors []error
+
+	for idx, preference := range n.Preferences {
+		if !isKnownNotificationType(preference.Type) {
+			validationErrors = append(validationErrors, newFieldError(jsonPointer("preferences", idx, "type"),
+				fmt.Errorf("notification type '%s' is invalid", preference.Type)))
+		}
+	}
+
+	return validationErrors
+}
+
+type NotificationPreferenceResponse struct {
+	Type        string `json:"type"`
+	PushEnabled bool   `json:"pushEnabled"`
+}
+
+type NotificationPreferencesResponse struct {
+	Preferences []NotificationPreferenceResponse `json:"preferences"`
+}
+
+func (s Server) GetNotificationsHandler(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(*models.User)
+
+	var cursor *storage.Cursor
+	if encodedCursor := c.Query("cursor"); len(encodedCursor) != 0 {
+		decodedCursor, err := decodeCursor(encodedCursor)
+		if err != nil {
+			UnprocessableRequestError(c, []error{errCursorInvalid})
+			return
+		}
+		cursor = decodedCursor
+	}
+
+	notificationConfig := s.settingsService.Current().NotificationConfig
+	size := notificationConfig.DefaultPageSize
+	if sizeParam := c.Query("size"); len(sizeParam) != 0 {
+		parsedSize, err := strconv.Atoi(sizeParam)
+		if err != nil || parsedSize <= 0 {
+			UnprocessableRequestError(c, []error{
+				errors.New("size must be a positive number"),
+			})
+			return
+		}
+		size = parsedSize
+	}
+	if maximumSize := notificationConfig.MaximumPageSize; maximumSize > 0 && size > maximumSize {
+		size = maximumSize
+	}
+
+	notifications, err := s.storageService.GetNotifications(c.Request.Context(), currentUser.Id, cursor, size)
+	if err != nil {
+		InternalServerError(c, err)
+		return
+	}
+
+	unreadCount, err := s.storageService.CountUnreadNotifications(c.Request.Context(), currentUser.Id)
+	if err != nil {
+		InternalServerError(c, err)
+		return
+	}
+
+	notificationResponses := make([]NotificationResponse, len(notifications))
+	for idx := range notifications {
+		notificationResponses[idx] = buildNotificationResponse(notifications[idx])
+	}
+
+	meta := NotificationsMeta{
+		UnreadCount: unreadCount,
+	}
+	if len(notifications) > 0 && len(notifications) >= size {
+		lastNotification := notifications[len(notifications)-1]
+		nextCursor := encodeCursor(storage.Cursor{
+			Timestamp: lastNotification.UpdatedAt,
+			Id:        lastNotification.Id,
+		})
+		meta.NextCursor = &nextCursor
+	}
+
+	resp := NotificationsResponse{
+		Notifications: notificationResponses,
+	}
+
+	WrapJSONAPI(c, http.StatusOK, resp, nil, meta)
+}
+
+func (s Server) MarkNotificationReadHandler(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(*models.User)
+
+	notificationId, err := strconv.ParseInt(c.Param("notificationId"), 10, 64)
+	if err != nil {
+		ResourceNotFoundError(c)
+		return
+	}
+
+	err = s.storageService.MarkNotificationRead(c.Request.Context(), currentUser.Id, notificationId)
+	if err != nil {
+		switch err.(type) {
+		case storage.RecordNotFoundError:
+			ResourceNotFoundError(c)
+			return
+		}
+
+		InternalServerError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (s Server) MarkAllNotificationsReadHandler(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(*models.User)
+
+	err := s.storageService.MarkAllNotificationsRead(c.Request.Context(), currentUser.Id)
+	if err != nil {
+		InternalServerError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (s Server) GetNotificationPreferencesHandler(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(*models.User)
+
+	preferences, err := s.storageService.GetNotificationPreferences(c.Request.Context(), currentUser.Id)
+	if err != nil {
+		InternalServerError(c, err)
+		return
+	}
+
+	resp := buildNotificationPreferencesResponse(preferences)
+
+	WrapJSONAPI(c, http.StatusOK, resp, nil, nil)
+}
+
+func (s Server) EditNotificationPreferencesHandler(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(*models.User)
+
+	var req NotificationPreferencesRequest
+	if !s.decodeJSONBody(c, &req) {
+		return
+	}
+
+	validationErrors := req.validate()
+	if validationErrors != nil {
+		UnprocessableRequestError(c, validationErrors)
+		return
+	}
+
+	preferences := make([]models.NotificationPreference, len(req.Preferences))
+	for idx, preference := range req.Preferences {
+		preferences[idx] = models.NotificationPreference{
+			NotificationType: models.NotificationType(preference.Type),
+			PushEnabled:      preference.PushEnabled,
+		}
+	}
+
+	savedPreferences, err := s.storageService.SaveNotificationPreferences(c.Request.Context(), currentUser.Id, preferences)
+	if err != nil {
+		InternalServerError(c, err)
+		return
+	}
+
+	resp := buildNotificationPreferencesResponse(savedPreferences)
+
+	WrapJSONAPI(c, http.StatusOK, resp, nil, nil)
+}
+
+func isKnownNotificationType(notificationType string) bool {
+	for _, knownNotificationType := range models.NotificationTypes {
+		if notificationType == string(knownNotificationType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Every known notification type is returned, defaulting to enabled where the
+// user has not saved a preference
+func buildNotificationPreferencesResponse(preferences []models.NotificationPreference) NotificationPreferencesResponse {
+	pushEnabledByType := make(map[models.NotificationType]bool)
+	for _, preference := range preferences {
+		pushEnabledByType[preference.NotificationType] = preference.PushEnabled
+	}
+
+	preferenceResponses := make([]NotificationPreferenceResponse, len(models.NotificationTypes))
+	for idx, notificationType := range models.NotificationTypes {
+		pushEnabled, exists := pushEnabledByType[notificationType]
+		preferenceResponses[idx] = NotificationPreferenceResponse{
+			Type:        string(notificationType),
+			PushEnabled: !exists || pushEnabled,
+		}
+	}
+
+	return NotificationPreferencesResponse{
+		Preferences: preferenceResponses,
+	}
+}
+
+func buildNotificationResponse(notification models.Notification) NotificationResponse {
+	return NotificationResponse{
+		Id:          notification.Id,
+		Type:        string(notification.Type),
+		TargetType:  string(notification.TargetType),
+		TargetId:    notification.TargetId,
+		LatestActor: buildMinimalUserResponse(notification.LatestActor),
+		ActorCount:  notification.ActorCount,
+		Read:        notification.ReadAt != nil,
+		CreatedAt:   notification.CreatedAt,
+		UpdatedAt:   notification.UpdatedAt,
+	}
+}
+
+// Cursors are opaque to clients and of the form "<unix nanoseconds>:<id>"
+func encodeCursor(cursor storage.Cursor) string {
+	rawCursor := fmt.Sprintf("%d:%d", cursor.Timestamp.UnixNano(), cursor.Id)
+	return base64.RawURLEncoding.EncodeToString([]byte(rawCursor))
+}
+
+func decodeCursor(encodedCursor string) (*storage.Cursor, error) {
+	rawCursor, err := base64.RawURLEncoding.DecodeString(encodedCursor)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := strings.Split(string(rawCursor), ":")
+	if len(tokens) != 2 {
+		return nil, errCursorInvalid
+	}
+
+	unixNano, err := strconv.ParseInt(tokens[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := strconv.ParseInt(tokens[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &storage.Cursor{
+		Timestamp: time.Unix(0, unixNano),
+		Id:        id,
+	}, nil
+}
@@ -0,0 +1,591 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The OpenAPI document is generated from the registered routes and the
+// request and response structs below. Every route needs an entry in
+// apiOperations, which openapi_test.go checks, and SetupRoutes also fails as
+// a backstop so the document cannot drift from the router
+
+const (
+	openAPIVersion         = "3.0.3"
+	openAPITitle           = "Angry Pros API"
+	openAPIDocumentVersion = "1.0.0"
+
+	securitySchemeFirebase = "firebaseAuth"
+)
+
+type apiOperation struct {
+	Summary string
+	// Body decoded from the request, nil when none is read
+	Request interface{}
+	// Payload under data and meta in the envelope, a nil response means the
+	// status carries no body
+	Response interface{}
+	Meta     interface{}
+	// Renders an HTML page rather than the JSON envelope
+	HTML        bool
+	Status      int
+	QueryParams []apiParameter
+}
+
+type apiParameter struct {
+	Name        string
+	Description string
+	Type        string
+	Format      string
+	Required    bool
+}
+
+var (
+	cursorParameter = apiParameter{
+		Name:        "cursor",
+		Description: "Opaque cursor from meta.nextCursor of the previous page",
+		Type:        "string",
+	}
+
+	// Keyed by method and route template, the same form used for per route
+	// request timeouts
+	apiOperations = map[string]apiOperation{
+		"GET /healthz": {
+			Summary:  "Liveness probe",
+			Response: HealthResponse{},
+			Status:   http.StatusOK,
+		},
+		"GET /readyz": {
+			Summary:  "Readiness probe, 503 when a dependency is unavailable or the server is shutting down",
+			Response: ReadinessResponse{},
+			Status:   http.StatusOK,
+		},
+		"GET /api/public/healthcheck": {
+			Summary:  "Liveness probe",
+			Response: HealthResponse{},
+			Status:   http.StatusOK,
+		},
+		"GET /api/public/openapi.json": {
+			Summary: "This document",
+			Status:  http.StatusOK,
+		},
+		"GET /api/public/countries": {
+			Summary:  "List selectable countries",
+			Response: CountriesResponse{},
+			Status:   http.StatusOK,
+		},
+		"GET /api/public/users/search": {
+			Summary:  "Search users by username prefix",
+			Response: UsersResponse{},
+			Status:   http.StatusOK,
+			QueryParams: []apiParameter{
+				{Name: "q", Description: "Username prefix, a leading @ is ignored", Type: "string"},
+			},
+		},
+		"GET /api/public/email/unsubscribe": {
+			Summary:     "Page confirming an unsubscribe from email digests using a signed link",
+			HTML:        true,
+			Status:      http.StatusOK,
+			QueryParams: unsubscribeParameters,
+		},
+		"POST /api/public/email/unsubscribe": {
+			Summary:     "Unsubscribe from email digests, also used for one click unsubscribe",
+			Response:    EmailPreferenceResponse{},
+			Status:      http.StatusOK,
+			QueryParams: unsubscribeParameters,
+		},
+		"GET /api/current-user": {
+			Summary:  "Get the signed in user with their roles and feature flags",
+			Response: CurrentUserResponse{},
+			Status:   http.StatusOK,
+		},
+		"POST /api/users": {
+			Summary:  "Register the signed in Firebase user",
+			Request:  BaseUserRequest{},
+			Response: UserResponse{},
+			Status:   http.StatusCreated,
+		},
+		"PUT /api/users": {
+			Summary:  "Edit the signed in user",
+			Request:  EditUserRequest{},
+			Response: UserResponse{},
+			Status:   http.StatusOK,
+		},
+		"GET /api/notifications": {
+			Summary:  "List notifications, newest first",
+			Response: NotificationsResponse{},
+			Meta:     NotificationsMeta{},
+			Status:   http.StatusOK,
+			QueryParams: []apiParameter{
+				cursorParameter,
+				{Name: "size", Description: "Page size, capped by the server", Type: "integer"},
+			},
+		},
+		"POST /api/notifications/read": {
+			Summary: "Mark every notification as read",
+			Status:  http.StatusNoContent,
+		},
+		"POST /api/notifications/:notificationId/read": {
+			Summary: "Mark a notification as read",
+			Status:  http.StatusNoContent,
+		},
+		"GET /api/notifications/preferences": {
+			Summary:  "Get push notification preferences",
+			Response: NotificationPreferencesResponse{},
+			Status:   http.StatusOK,
+		},
+		"PUT /api/notifications/preferences": {
+			Summary:  "Edit push notification preferences",
+			Request:  NotificationPreferencesRequest{},
+			Response: NotificationPreferencesResponse{},
+			Status:   http.StatusOK,
+		},
+		"POST /api/devices": {
+			Summary:  "Register a device for push notifications",
+			Request:  RegisterDeviceRequest{},
+			Response: DeviceResponse{},
+			Status:   http.StatusCreated,
+		},
+		"DELETE /api/devices/:token": {
+			Summary: "Unregister a device from push notifications",
+			Status:  http.StatusNoContent,
+		},
+		"GET /api/email/preferences": {
+			Summary:  "Get the email digest preference",
+			Response: EmailPreferenceResponse{},
+			Status:   http.StatusOK,
+		},
+		"PUT /api/email/preferences": {
+			Summary:  "Edit the email digest preference",
+			Request:  EmailPreferenceRequest{},
+			Response: EmailPreferenceResponse{},
+			Status:   http.StatusOK,
+		},
+		"POST /api/reports": {
+			Summary:  "Report a user or content",
+			Request:  CreateReportRequest{},
+			Response: ReportResponse{},
+			Status:   http.StatusCreated,
+		},
+		"GET /api/moderation/reports": {
+			Summary:  "List reports, optionally filtered by status",
+			Response: ReportsResponse{},
+			Meta:     ReportsMeta{},
+			Status:   http.StatusOK,
+			QueryParams: []apiParameter{
+				cursorParameter,
+				{Name: "status", Description: "Only reports with this status", Type: "string"},
+			},
+		},
+		"POST /api/moderation/reports/:reportId/claim": {
+			Summary:  "Claim a report for review",
+			Response: ReportResponse{},
+			Status:   http.StatusOK,
+		},
+		"POST /api/moderation/reports/:reportId/resolve": {
+			Summary:  "Resolve a claimed report with an action",
+			Request:  ResolveReportRequest{},
+			Response: ReportResponse{},
+			Status:   http.StatusOK,
+		},
+		"POST /api/moderation/reports/:reportId/dismiss": {
+			Summary:  "Dismiss a claimed report without action",
+			Response: ReportResponse{},
+			Status:   http.StatusOK,
+		},
+		"PUT /api/moderation/users/:userId/suspension": {
+			Summary:  "Suspend a user",
+			Request:  SuspendUserRequest{},
+			Response: ModeratedUserResponse{},
+			Status:   http.StatusOK,
+		},
+		"DELETE /api/moderation/users/:userId/suspension": {
+			Summary:  "Lift a user's suspension",
+			Response: ModeratedUserResponse{},
+			Status:   http.StatusOK,
+		},
+		"PUT /api/moderation/users/:userId/shadowban": {
+			Summary:  "Shadowban a user",
+			Response: ModeratedUserResponse{},
+			Status:   http.StatusOK,
+		},
+		"DELETE /api/moderation/users/:userId/shadowban": {
+			Summary:  "Lift a user's shadowban",
+			Response: ModeratedUserResponse{},
+			Status:   http.StatusOK,
+		},
+		"GET /api/admin/users/:userId/roles": {
+			Summary:  "Get a user's roles",
+			Response: UserRolesResponse{},
+			Status:   http.StatusOK,
+		},
+		"PUT /api/admin/users/:userId/roles": {
+			Summary:  "Replace a user's roles",
+			Request:  UserRolesRequest{},
+			Response: UserRolesResponse{},
+			Status:   http.StatusOK,
+		},
+		"GET /api/admin/audit-log": {
+			Summary:  "List audit log entries, newest first",
+			Response: AuditLogResponse{},
+			Meta:     AuditLogMeta{},
+			Status:   http.StatusOK,
+			QueryParams: []apiParameter{
+				cursorParameter,
+				{Name: "actorUserId", Description: "Only entries performed by this user", Type: "integer", Format: "int64"},
+				{Name: "targetType", Description: "Only entries for this target type", Type: "string"},
+				{Name: "targetId", Description: "Only entries for this target id", Type: "integer", Format: "int64"},
+				{Name: "from", Description: "Only entries at or after this time", Type: "string", Format: "date-time"},
+				{Name: "to", Description: "Only entries before this time", Type: "string", Format: "date-time"},
+			},
+		},
+	}
+
+	unsubscribeParameters = []apiParameter{
+		{Name: "userId", Type: "integer", Format: "int64", Required: true},
+		{Name: "signature", Description: "Signature from the digest email link", Type: "string", Required: true},
+	}
+
+	// Path parameters not listed here are strings
+	pathParameterTypes = map[string]apiParameter{
+		"notificationId": {Type: "integer", Format: "int64"},
+		"reportId":       {Type: "integer", Format: "int64"},
+		"userId":         {Type: "integer", Format: "int64"},
+	}
+)
+
+func (s Server) OpenAPIHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", *s.openAPIDocument)
+}
+
+func buildOpenAPIDocument(routes gin.RoutesInfo) ([]byte, error) {
+	schemas := newSchemaRegistry()
+	paths := make(map[string]map[string]interface{})
+	documented := make(map[string]bool)
+	var undocumented []string
+
+	for _, route := range routes {
+		key := fmt.Sprintf("%s %s", route.Method, route.Path)
+		operation, exists := apiOperations[key]
+		if !exists {
+			undocumented = append(undocumented, key)
+			continue
+		}
+		documented[key] = true
+
+		path, pathParameters := openAPIPath(route.Path)
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(route.Method)] = buildOperation(schemas, route.Path, operation, pathParameters)
+	}
+
+	var stale []string
+	for key := range apiOperations {
+		if !documented[key] {
+			stale = append(stale, key)
+		}
+	}
+
+	if len(undocumented) != 0 || len(stale) != 0 {
+		sort.Strings(undocumented)
+		sort.Strings(stale)
+
+		var problems []string
+		if len(undocumented) != 0 {
+			problems = append(problems, fmt.Sprintf("routes without an OpenAPI entry: %s",
+				strings.Join(undocumented, ", ")))
+		}
+		if len(stale) != 0 {
+			problems = append(problems, fmt.Sprintf("OpenAPI entries without a route: %s",
+				strings.Join(stale, ", ")))
+		}
+
+		return nil, fmt.Errorf("api operations are out of date, %s", strings.Join(problems, "; "))
+	}
+
+	schemas.add(reflect.TypeOf(ResponseError{}))
+
+	document := map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{
+			"title":   openAPITitle,
+			"version": openAPIDocumentVersion,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.schemas,
+			"securitySchemes": map[string]interface{}{
+				securitySchemeFirebase: map[string]interface{}{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "Firebase ID token",
+				},
+			},
+			"responses": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"description": "One or more errors, see each code",
+					"content": jsonContent(map[string]interface{}{
+						"type":     "object",
+						"required": []string{"errors"},
+						"properties": map[string]interface{}{
+							"errors": map[string]interface{}{
+								"type":  "array",
+								"items": schemaRef("ResponseError"),
+							},
+						},
+					}),
+				},
+			},
+		},
+	}
+
+	return json.Marshal(document)
+}
+
+func buildOperation(schemas *schemaRegistry, routePath string, operation apiOperation,
+	pathParameters []string) map[string]interface{} {
+	var parameters []interface{}
+	for _, name := range pathParameters {
+		parameterType, exists := pathParameterTypes[name]
+		if !exists {
+			parameterType = apiParameter{Type: "string"}
+		}
+		parameterType.Name = name
+		parameterType.Required = true
+		parameters = append(parameters, buildParameter("path", parameterType))
+	}
+	for _, queryParameter := range operation.QueryParams {
+		parameters = append(parameters, buildParameter("query", queryParameter))
+	}
+
+	response := map[string]interface{}{
+		"description": http.StatusText(operation.Status),
+	}
+	if operation.Response != nil {
+		properties := map[string]interface{}{
+			"data": schemas.add(reflect.TypeOf(operation.Response)),
+		}
+		required := []string{"data"}
+		if operation.Meta != nil {
+			properties["meta"] = schemas.add(reflect.TypeOf(operation.Meta))
+			required = append(required, "meta")
+		}
+
+		response["content"] = jsonContent(map[string]interface{}{
+			"type":       "object",
+			"required":   required,
+			"properties": properties,
+		})
+	}
+	if operation.HTML {
+		response["content"] = map[string]interface{}{
+			htmlMediaType: map[string]interface{}{
+				"schema": map[string]interface{}{"type": "string"},
+			},
+		}
+	}
+
+	built := map[string]interface{}{
+		"summary": operation.Summary,
+		"responses": map[string]interface{}{
+			fmt.Sprint(operation.Status): response,
+			"default":                    map[string]interface{}{"$ref": "#/components/responses/Error"},
+		},
+		"security": routeSecurity(routePath),
+	}
+	if len(parameters) != 0 {
+		built["parameters"] = parameters
+	}
+	if operation.Request != nil {
+		built["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  jsonContent(schemas.add(reflect.TypeOf(operation.Request))),
+		}
+	}
+
+	return built
+}
+
+func buildParameter(in string, parameter apiParameter) map[string]interface{} {
+	schema := map[string]interface{}{
+		"type": parameter.Type,
+	}
+	if len(parameter.Format) != 0 {
+		schema["format"] = parameter.Format
+	}
+
+	built := map[string]interface{}{
+		"name":     parameter.Name,
+		"in":       in,
+		"required": parameter.Required,
+		"schema":   schema,
+	}
+	if len(parameter.Description) != 0 {
+		built["description"] = parameter.Description
+	}
+
+	return built
+}
+
+// Mirrors the middleware applied to each route group in SetupRoutes
+func routeSecurity(routePath string) []interface{} {
+	firebase := map[string]interface{}{securitySchemeFirebase: []string{}}
+
+	switch {
+	case strings.HasPrefix(routePath, "/api/public/"):
+		return []interface{}{map[string]interface{}{}, firebase}
+	case strings.HasPrefix(routePath, "/api/"):
+		return []interface{}{firebase}
+	}
+
+	return []interface{}{}
+}
+
+// Converts gin parameters such as :userId into {userId}
+func openAPIPath(routePath string) (string, []string) {
+	var parameters []string
+	segments := strings.Split(routePath, "/")
+	for idx, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			name := segment[1:]
+			parameters = append(parameters, name)
+			segments[idx] = fmt.Sprintf("{%s}", name)
+		}
+	}
+
+	return strings.Join(segments, "/"), parameters
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{
+			"schema": schema,
+		},
+	}
+}
+
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// Named structs become components referenced by name, everything else is
+// described inline
+type schemaRegistry struct {
+	schemas map[string]interface{}
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{
+		schemas: make(map[string]interface{}),
+	}
+}
+
+func (r *schemaRegistry) add(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := r.add(t.Elem())
+		if _, isRef := schema["$ref"]; isRef {
+			return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Struct:
+		if len(t.Name()) == 0 {
+			return r.object(t)
+		}
+		if _, exists := r.schemas[t.Name()]; !exists {
+			// Registered before describing fields so recursive types terminate
+			r.schemas[t.Name()] = map[string]interface{}{}
+			r.schemas[t.Name()] = r.object(t)
+		}
+		return schemaRef(t.Name())
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": r.add(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": r.add(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int32, reflect.Int16, reflect.Int8, reflect.Uint32, reflect.Uint16, reflect.Uint8:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	}
+
+	return map[string]interface{}{}
+}
+
+func (r *schemaRegistry) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	r.addFields(t, properties, &required)
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) != 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+
+	return schema
+}
+
+// Embedded structs without a JSON name are flattened as encoding/json does
+func (r *schemaRegistry) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tagParts := strings.Split(field.Tag.Get("json"), ",")
+		name := tagParts[0]
+		if name == "-" {
+			continue
+		}
+
+		if field.Anonymous && len(name) == 0 && field.Type.Kind() == reflect.Struct {
+			r.addFields(field.Type, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+
+		properties[name] = r.add(field.Type)
+
+		omitEmpty := false
+		for _, option := range tagParts[1:] {
+			if option == "omitempty" {
+				omitEmpty = true
+			}
+		}
+		if !omitEmpty {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rawfish-dev/angrypros-api/config"
+)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	// Route registration only wires middleware, so no services are needed
+	server, err := NewServer(config.AppConfig{}, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("could not create server: %s", err)
+	}
+
+	return server
+}
+
+func TestEveryRouteHasAnOpenAPIOperation(t *testing.T) {
+	server := newTestServer(t)
+	setupErr := server.SetupRoutes()
+
+	routes := make(map[string]bool)
+	for _, route := range server.router.Routes() {
+		key := fmt.Sprintf("%s %s", route.Method, route.Path)
+		routes[key] = true
+
+		if _, exists := apiOperations[key]; !exists {
+			t.Errorf("route %s has no entry in apiOperations", key)
+		}
+	}
+
+	for key := range apiOperations {
+		if !routes[key] {
+			t.Errorf("apiOperations entry %s has no route", key)
+		}
+	}
+
+	if setupErr != nil {
+		t.Errorf("SetupRoutes failed: %s", setupErr)
+	}
+}
+
+func TestOpenAPIDocumentIsServed(t *testing.T) {
+	server := newTestServer(t)
+	err := server.SetupRoutes()
+	if err != nil {
+		t.Fatalf("SetupRoutes failed: %s", err)
+	}
+
+	// The public group rate limits, so call the handler directly
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/public/openapi.json", nil)
+	server.OpenAPIHandler(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var document struct {
+		OpenAPI string                 `json:"openapi"`
+		Paths   map[string]interface{} `json:"paths"`
+	}
+	err = json.Unmarshal(w.Body.Bytes(), &document)
+	if err != nil {
+		t.Fatalf("document is not valid JSON: %s", err)
+	}
+	if document.OpenAPI != openAPIVersion {
+		t.Errorf("expected openapi %s, got %s", openAPIVersion, document.OpenAPI)
+	}
+	if _, exists := document.Paths["/api/moderation/users/{userId}/suspension"]; !exists {
+		t.Errorf("expected gin path parameters to be converted, got paths %v", document.Paths)
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+	"github.com/rawfish-dev/angrypros-api/services/ratelimit"
+	"github.com/rawfish-dev/angrypros-api/services/ratelimit/limits"
+	"github.com/rawfish-dev/angrypros-api/services/spam"
+)
+
+const (
+	headerKeyRetryAfter = "Retry-After"
+)
+
+// Must be used after optionalAuthMiddleware or authMiddleware so that
+// callers are keyed by user rather than IP whenever possible. New accounts
+// must also stay within the new-account variant of the limit when configured
+func rateLimitMiddleware(r ratelimit.RateLimiter, sp spam.SpamService, limitName string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subject := rateLimitSubject(c)
+
+		limitNames := []string{limitName}
+		currentUser, exists := c.Get("currentUser")
+		if exists && sp.IsNewAccount(c.Request.Context(), *currentUser.(*models.User)) {
+			limitNames = append(limitNames, limitName+limits.NewAccountSuffix)
+		}
+
+		for _, name := range limitNames {
+			allowed, retryAfter := r.Allow(c.Request.Context(), name, subject)
+			if !allowed {
+				c.Header(headerKeyRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				TooManyRequestsError(c)
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+func rateLimitSubject(c *gin.Context) string {
+	currentUser, exists := c.Get("currentUser")
+	if exists {
+		return fmt.Sprintf("user:%d", currentUser.(*models.User).Id)
+	}
+
+	return fmt.Sprintf("ip:%s", c.ClientIP())
+}
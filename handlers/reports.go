@@ -0,0 +1,478 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+	"github.com/rawfish-dev/angrypros-api/services/storage"
+)
+
+const (
+	reportDetailsMaximumLength = 1000
+)
+
+var (
+	errCannotReportSelf       = errors.New("users cannot report themselves")
+	errReportAlreadySubmitted = errors.New("target has already been reported")
+	errReportNotActionable    = errors.New("report is closed or claimed by another moderator")
+)
+
+type CreateReportRequest struct {
+	TargetType string `json:"targetType"`
+	TargetId   int64  `json:"targetId"`
+	Reason     string `json:"reason"`
+	Details    string `json:"details"`
+}
+
+func (c CreateReportRequest) validate() []error {
+	var validationErrors []error
+
+	validTargetType := false
+	for _, targetType := range models.ReportTargetTypes {
+		if c.TargetType == string(targetType) {
+			validTargetType = true
+			break
+		}
+	}
+	if !validTargetType {
+		validationErrors = append(validationErrors, newFieldError("/targetType", errors.New("target type is invalid")))
+	}
+
+	validReason := false
+	for _, reason := range models.ReportReasons {
+		if c.Reason == string(reason) {
+			validReason = true
+			break
+		}
+	}
+	if !validReason {
+		validationErrors = append(validationErrors, newFieldError("/reason", errors.New("reason is invalid")))
+	}
+
+	if utf8.RuneCountInString(c.Details) > reportDetailsMaximumLength {
+		validationErrors = append(validationErrors, newFieldError("/details",
+			fmt.Errorf("details must be at most %d characters", reportDetailsMaximumLength)))
+	}
+
+	return validationErrors
+}
+
+type ResolveReportRequest struct {
+	Action         string     `json:"action"`
+	Reason         string     `json:"reason"`
+	SuspendedUntil *time.Time `json:"suspendedUntil"`
+}
+
+func (r ResolveReportRequest) validate(now time.Time) []error {
+	var validationErrors []error
+
+	validAction := false
+	for _, action := range models.ModerationActions {
+		if r.Action == string(action) {
+			validAction = true
+			break
+		}
+	}
+	if !validAction {
+		validationErrors = append(validationErrors, newFieldError("/action", errors.New("action is invalid")))
+	}
+
+	if r.Action == string(models.ModerationActionSuspend) &&
+		(r.SuspendedUntil == nil || !r.SuspendedUntil.After(now)) {
+		validationErrors = append(validationErrors, newFieldError("/suspendedUntil",
+			errors.New("suspended until must be in the future when suspending")))
+	}
+
+	if (r.Action == string(models.ModerationActionWarn) ||
+		r.Action == string(models.ModerationActionSuspend)) && len(r.Reason) == 0 {
+		validationErrors = append(validationErrors, newFieldError("/reason",
+			errors.New("reason is required when warning or suspending")))
+	}
+
+	return validationErrors
+}
+
+type ReportResponse struct {
+	Id               int64         `json:"id"`
+	TargetType       string        `json:"targetType"`
+	TargetId         int64         `json:"targetId"`
+	Reason           string        `json:"reason"`
+	Details          string        `json:"details,omitempty"`
+	Status           string        `json:"status"`
+	ResolutionAction *string       `json:"resolutionAction"`
+	Reporter         *UserResponse `json:"reporter,omitempty"`
+	Moderator        *UserResponse `json:"moderator,omitempty"`
+	ClaimedAt        *time.Time    `json:"claimedAt"`
+	ClosedAt         *time.Time    `json:"closedAt"`
+	CreatedAt        time.Time     `json:"createdAt"`
+}
+
+type ReportsResponse struct {
+	Reports []ReportResponse `json:"reports"`
+}
+
+type ReportsMeta struct {
+	NextCursor *string `json:"nextCursor"`
+}
+
+func (s Server) CreateReportHandler(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(*models.User)
+
+	var req CreateReportRequest
+	if !s.decodeJSONBody(c, &req) {
+		return
+	}
+
+	validationErrors := req.validate()
+	if validationErrors != nil {
+		UnprocessableRequestError(c, validationErrors)
+		return
+	}
+
+	targetType := models.ReportTargetType(req.TargetType)
+
+	switch targetType {
+	case models.ReportTargetTypeUser:
+		if req.TargetId == currentUser.Id {
+			UnprocessableRequestError(c, []error{newFieldError("/targetId", errCannotReportSelf)})
+			return
+		}
+
+		_, err := s.storageService.GetUserById(c.Request.Context(), req.TargetId)
+		if err != nil {
+			switch err.(type) {
+			case storage.RecordNotFoundError:
+				ResourceNotFoundError(c)
+				return
+			}
+
+			InternalServerError(c, err)
+			return
+		}
+	}
+
+	spamResult, err := s.spamService.Check(c.Request.Context(), *currentUser, req.Details)
+	if err != nil {
+		InternalServerError(c, err)
+		return
+	}
+	if spamResult.Rejections != nil {
+		UnprocessableRequestError(c, fieldErrors("/details", spamResult.Rejections))
+		return
+	}
+
+	report, err := s.storageService.CreateReport(c.Request.Context(), currentUser.Id, targetType, req.TargetId,
+		models.ReportReason(req.Reason), req.Details, s.settingsService.Current().ModerationConfig.AutoHideReportThreshold)
+	if err != nil {
+		switch err.(type) {
+		case storage.ReportAlreadyExistsError:
+			UnprocessableRequestError(c, []error{errReportAlreadySubmitted})
+			return
+		}
+
+		InternalServerError(c, err)
+		return
+	}
+
+	// Reports cannot themselves be reported so the account is flagged instead
+	s.flagSpamForModeration(c, models.ReportTargetTypeUser, currentUser.Id, *spamResult)
+
+	// Reporters only see their own report without moderator details
+	resp := buildReportResponse(*report, false)
+
+	WrapJSONAPI(c, http.StatusCreated, resp, nil, nil)
+}
+
+func (s Server) GetReportsHandler(c *gin.Context) {
+	var status *models.ReportStatus
+	if statusParam := c.Query("status"); len(statusParam) != 0 {
+		validStatus := false
+		for _, reportStatus := range models.ReportStatuses {
+			if statusParam == string(reportStatus) {
+				validStatus = true
+				break
+			}
+		}
+		if !validStatus {
+			UnprocessableRequestError(c, []error{errors.New("status is invalid")})
+			return
+		}
+
+		reportStatus := models.ReportStatus(statusParam)
+		status = &reportStatus
+	}
+
+	var cursor *storage.Cursor
+	if encodedCursor := c.Query("cursor"); len(encodedCursor) != 0 {
+		decodedCursor, err := decodeCursor(encodedCursor)
+		if err != nil {
+			UnprocessableRequestError(c, []error{errCursorInvalid})
+			return
+		}
+		cursor = decodedCursor
+	}
+
+	size := s.settingsService.Current().ModerationConfig.DefaultPageSize
+
+	reports, err := s.storageService.GetReports(c.Request.Context(), status, cursor, size)
+	if err != nil {
+		InternalServerError(c, err)
+		return
+	}
+
+	reportResponses := make([]ReportResponse, len(reports))
+	for idx := range reports {
+		reportResponses[idx] = buildReportResponse(reports[idx], true)
+	}
+
+	var meta ReportsMeta
+	if len(reports) > 0 && len(reports) >= size {
+		lastReport := reports[len(reports)-1]
+		nextCursor := encodeCursor(storage.Cursor{
+			Timestamp: lastReport.CreatedAt,
+			Id:        lastReport.Id,
+		})
+		meta.NextCursor = &nextCursor
+	}
+
+	resp := ReportsResponse{
+		Reports: reportResponses,
+	}
+
+	WrapJSONAPI(c, http.StatusOK, resp, nil, meta)
+}
+
+func (s Server) ClaimReportHandler(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(*models.User)
+
+	reportId, err := strconv.ParseInt(c.Param("reportId"), 10, 64)
+	if err != nil {
+		ResourceNotFoundError(c)
+		return
+	}
+
+	var report *models.Report
+	err = s.auditService.Perform(c.Request.Context(),
+		s.auditEntry(c, models.AuditActionClaimReport, models.AuditTargetTypeReport, reportId),
+		func(tx storage.StorageService) (interface{}, interface{}, error) {
+			before, err := tx.GetReportById(c.Request.Context(), reportId)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			report, err = tx.ClaimReport(c.Request.Context(), reportId, currentUser.Id)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return buildReportResponse(*before, true), buildReportResponse(*report, true), nil
+		})
+	if err != nil {
+		handleReportActionError(c, err)
+		return
+	}
+
+	resp := buildReportResponse(*report, true)
+
+	WrapJSONAPI(c, http.StatusOK, resp, nil, nil)
+}
+
+func (s Server) ResolveReportHandler(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(*models.User)
+
+	reportId, err := strconv.ParseInt(c.Param("reportId"), 10, 64)
+	if err != nil {
+		ResourceNotFoundError(c)
+		return
+	}
+
+	var req ResolveReportRequest
+	if !s.decodeJSONBody(c, &req) {
+		return
+	}
+
+	validationErrors := req.validate(s.timeService.Now(c.Request.Context()))
+	if validationErrors != nil {
+		UnprocessableRequestError(c, validationErrors)
+		return
+	}
+
+	existingReport, err := s.storageService.GetReportById(c.Request.Context(), reportId)
+	if err != nil {
+		handleReportActionError(c, err)
+		return
+	}
+	if existingReport.TargetType == models.ReportTargetTypeUser &&
+		!s.canModerateUser(c, existingReport.TargetId) {
+		return
+	}
+
+	resolution := storage.ReportResolution{
+		Action:         models.ModerationAction(req.Action),
+		Reason:         req.Reason,
+		SuspendedUntil: req.SuspendedUntil,
+	}
+
+	var report *models.Report
+	err = s.auditService.Perform(c.Request.Context(),
+		s.auditEntry(c, models.AuditActionResolveReport, models.AuditTargetTypeReport, reportId),
+		func(tx storage.StorageService) (interface{}, interface{}, error) {
+			before, err := buildReportSnapshot(c.Request.Context(), tx, reportId)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			_, err = tx.ResolveReport(c.Request.Context(), reportId, currentUser.Id, resolution)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			after, err := buildReportSnapshot(c.Request.Context(), tx, reportId)
+			if err != nil {
+				return nil, nil, err
+			}
+			report = after.report
+
+			return before, after, nil
+		})
+	if err != nil {
+		handleReportActionError(c, err)
+		return
+	}
+
+	resp := buildReportResponse(*report, true)
+
+	WrapJSONAPI(c, http.StatusOK, resp, nil, nil)
+}
+
+func (s Server) DismissReportHandler(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(*models.User)
+
+	reportId, err := strconv.ParseInt(c.Param("reportId"), 10, 64)
+	if err != nil {
+		ResourceNotFoundError(c)
+		return
+	}
+
+	var report *models.Report
+	err = s.auditService.Perform(c.Request.Context(),
+		s.auditEntry(c, models.AuditActionDismissReport, models.AuditTargetTypeReport, reportId),
+		func(tx storage.StorageService) (interface{}, interface{}, error) {
+			before, err := tx.GetReportById(c.Request.Context(), reportId)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			report, err = tx.DismissReport(c.Request.Context(), reportId, currentUser.Id)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return buildReportResponse(*before, true), buildReportResponse(*report, true), nil
+		})
+	if err != nil {
+		handleReportActionError(c, err)
+		return
+	}
+
+	resp := buildReportResponse(*report, true)
+
+	WrapJSONAPI(c, http.StatusOK, resp, nil, nil)
+}
+
+func handleReportActionError(c *gin.Context, err error) {
+	switch err.(type) {
+	case storage.RecordNotFoundError:
+		ResourceNotFoundError(c)
+		return
+	case storage.ReportNotActionableError:
+		UnprocessableRequestError(c, []error{errReportNotActionable})
+		return
+	case storage.ModerationNotPermittedError:
+		ForbiddenError(c)
+		return
+	}
+
+	InternalServerError(c, err)
+}
+
+// Resolutions change the reported target as well as the report, so the
+// audit snapshot covers both
+type reportSnapshot struct {
+	Report     ReportResponse         `json:"report"`
+	TargetUser *ModeratedUserResponse `json:"targetUser"`
+
+	report *models.Report
+}
+
+func buildReportSnapshot(ctx context.Context, tx storage.StorageService, reportId int64) (*reportSnapshot, error) {
+	report, err := tx.GetReportById(ctx, reportId)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &reportSnapshot{
+		Report: buildReportResponse(*report, true),
+		report: report,
+	}
+
+	if report.TargetType == models.ReportTargetTypeUser {
+		// Deleted users are no longer found which is left as a nil target
+		targetUser, err := tx.GetUserById(ctx, report.TargetId)
+		if err != nil {
+			switch err.(type) {
+			case storage.RecordNotFoundError:
+				return snapshot, nil
+			}
+
+			return nil, err
+		}
+
+		moderatedUser := buildModeratedUserResponse(*targetUser)
+		snapshot.TargetUser = &moderatedUser
+	}
+
+	return snapshot, nil
+}
+
+func buildReportResponse(report models.Report, includeParticipants bool) ReportResponse {
+	resp := ReportResponse{
+		Id:         report.Id,
+		TargetType: string(report.TargetType),
+		TargetId:   report.TargetId,
+		Reason:     string(report.Reason),
+		Status:     string(report.Status),
+		ClaimedAt:  report.ClaimedAt,
+		ClosedAt:   report.ClosedAt,
+		CreatedAt:  report.CreatedAt,
+	}
+
+	if report.ResolutionAction != nil {
+		resolutionAction := string(*report.ResolutionAction)
+		resp.ResolutionAction = &resolutionAction
+	}
+
+	if includeParticipants {
+		resp.Details = report.Details
+
+		if report.Reporter != nil {
+			reporter := buildMinimalUserResponse(*report.Reporter)
+			resp.Reporter = &reporter
+		}
+
+		if report.Moderator != nil {
+			moderator := buildMinimalUserResponse(*report.Moderator)
+			resp.Moderator = &moderator
+		}
+	}
+
+	return resp
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -10,19 +12,31 @@ import (
 type ResponseCode string
 
 const (
+	AccountSuspended     ResponseCode = "account-suspended"
 	AuthIncomplete       ResponseCode = "auth-incomplete"
+	Forbidden            ResponseCode = "forbidden"
 	GeneralServerError   ResponseCode = "general-server-error"
 	InvalidAuth          ResponseCode = "invalid-auth"
 	MalformedRequest     ResponseCode = "malformed-request"
 	NoAuth               ResponseCode = "no-auth"
+	RateLimited          ResponseCode = "rate-limited"
+	RequestTimedOut      ResponseCode = "request-timed-out"
+	RequestTooLarge      ResponseCode = "request-too-large"
 	ResourceNotFound     ResponseCode = "resource-not-found"
 	UnprocessableRequest ResponseCode = "unprocessable-request"
+	UnsupportedMediaType ResponseCode = "unsupported-media-type"
 )
 
 type ResponseError struct {
-	Code   string `json:"code,omitempty"`
-	Title  string `json:"title"`
-	Detail string `json:"detail"`
+	Code   string               `json:"code,omitempty"`
+	Title  string               `json:"title"`
+	Detail string               `json:"detail"`
+	Source *ResponseErrorSource `json:"source,omitempty"`
+}
+
+// Pointer is a JSON pointer into the request body such as /preferences/0/type
+type ResponseErrorSource struct {
+	Pointer string `json:"pointer"`
 }
 
 func WrapJSONAPI(c *gin.Context, httpStatus int, payload interface{}, errors []ResponseError, meta interface{}) {
@@ -50,7 +64,7 @@ func WrapJSONAPI(c *gin.Context, httpStatus int, payload interface{}, errors []R
 }
 
 func MalformedRequestError(c *gin.Context, err error) {
-	log.Printf("returning malformed request error due to %s", err)
+	requestLogger(c).Info("returning malformed request error", "error", err)
 
 	WrapJSONAPI(c, http.StatusBadRequest, nil, []ResponseError{
 		{
@@ -61,6 +75,26 @@ func MalformedRequestError(c *gin.Context, err error) {
 	}, nil)
 }
 
+func UnsupportedMediaTypeError(c *gin.Context) {
+	WrapJSONAPI(c, http.StatusUnsupportedMediaType, nil, []ResponseError{
+		{
+			Code:   string(UnsupportedMediaType),
+			Title:  "Unsupported media type",
+			Detail: "Request body must be sent with a Content-Type of application/json",
+		},
+	}, nil)
+}
+
+func RequestTooLargeError(c *gin.Context, limit int64) {
+	WrapJSONAPI(c, http.StatusRequestEntityTooLarge, nil, []ResponseError{
+		{
+			Code:   string(RequestTooLarge),
+			Title:  "Request was too large",
+			Detail: fmt.Sprintf("Request body must be at most %s", formatBytes(limit)),
+		},
+	}, nil)
+}
+
 func ResourceNotFoundError(c *gin.Context) {
 	WrapJSONAPI(c, http.StatusNotFound, nil, []ResponseError{
 		{
@@ -71,8 +105,32 @@ func ResourceNotFoundError(c *gin.Context) {
 	}, nil)
 }
 
+func ForbiddenError(c *gin.Context) {
+	WrapJSONAPI(c, http.StatusForbidden, nil, []ResponseError{
+		{
+			Code:   string(Forbidden),
+			Title:  "Access denied",
+			Detail: "Current user is not allowed to perform this action",
+		},
+	}, nil)
+}
+
+func TooManyRequestsError(c *gin.Context) {
+	WrapJSONAPI(c, http.StatusTooManyRequests, nil, []ResponseError{
+		{
+			Code:   string(RateLimited),
+			Title:  "Too many requests",
+			Detail: "Too many requests were made in a short time, please try again later",
+		},
+	}, nil)
+}
+
 func UnprocessableRequestError(c *gin.Context, errors []error) {
-	log.Printf("returning unprocessable request error due to %+v", errors)
+	details := make([]string, len(errors))
+	for i := 0; i < len(errors); i++ {
+		details[i] = errors[i].Error()
+	}
+	requestLogger(c).Info("returning unprocessable request error", "errors", details)
 
 	responseErrors := make([]ResponseError, len(errors))
 	for i := 0; i < len(errors); i++ {
@@ -81,13 +139,34 @@ func UnprocessableRequestError(c *gin.Context, errors []error) {
 			Title:  "Request could not be processed",
 			Detail: errors[i].Error(),
 		}
+
+		if pointer, exists := fieldErrorPointer(errors[i]); exists {
+			responseErrors[i].Source = &ResponseErrorSource{
+				Pointer: pointer,
+			}
+		}
 	}
 
 	WrapJSONAPI(c, http.StatusUnprocessableEntity, nil, responseErrors, nil)
 }
 
 func InternalServerError(c *gin.Context, err error) {
-	log.Printf("returning internal server error due to %v", err)
+	// Failures caused by the request deadline passing are reported as such
+	// rather than as a general error
+	if errors.Is(c.Request.Context().Err(), context.DeadlineExceeded) {
+		requestLogger(c).Warn("returning request timed out error", "error", err)
+
+		WrapJSONAPI(c, http.StatusServiceUnavailable, nil, []ResponseError{
+			{
+				Code:   string(RequestTimedOut),
+				Title:  "Request timed out",
+				Detail: "The request took too long to process, please try again later",
+			},
+		}, nil)
+		return
+	}
+
+	requestLogger(c).Error("returning internal server error", "error", err)
 
 	WrapJSONAPI(c, http.StatusInternalServerError, nil, []ResponseError{
 		{
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+	"github.com/rawfish-dev/angrypros-api/services/screening"
+)
+
+// Explains why screened text for the field was refused, fields which cannot
+// sensibly be shown masked such as usernames treat masks as rejections
+func screeningErrors(field string, result screening.Result, allowMasking bool) []error {
+	violations := result.Rejections
+	if !allowMasking {
+		violations = append(violations, result.Masks...)
+	}
+
+	var errs []error
+	for _, violation := range violations {
+		errs = append(errs, newFieldError(jsonPointer(field), fmt.Errorf("%s %s", field, violation.Description)))
+	}
+
+	return errs
+}
+
+// Best effort as the content has already been accepted by this point
+func (s Server) flagForModeration(c *gin.Context, targetType models.ReportTargetType, targetId int64, result screening.Result) {
+	if !result.Flagged() {
+		return
+	}
+
+	descriptions := make([]string, len(result.Flags))
+	for idx, flag := range result.Flags {
+		descriptions[idx] = flag.Description
+	}
+
+	_, err := s.storageService.CreateAutomatedReport(c.Request.Context(), targetType, targetId,
+		fmt.Sprintf("screening flagged content which %s", strings.Join(descriptions, ", ")))
+	if err != nil {
+		requestLogger(c).Error("unable to flag for moderation",
+			"target_type", targetType, "target_id", targetId, "error", err)
+	}
+}
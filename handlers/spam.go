@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+	"github.com/rawfish-dev/angrypros-api/services/spam"
+)
+
+// Best effort as the content has already been accepted by this point
+func (s Server) flagSpamForModeration(c *gin.Context, targetType models.ReportTargetType, targetId int64, result spam.Result) {
+	if !result.Flagged() {
+		return
+	}
+
+	_, err := s.storageService.CreateAutomatedReport(c.Request.Context(), targetType, targetId,
+		fmt.Sprintf("spam checks flagged a new account which %s", strings.Join(result.Flags, ", ")))
+	if err != nil {
+		requestLogger(c).Error("unable to flag for moderation",
+			"target_type", targetType, "target_id", targetId, "error", err)
+	}
+}
@@ -18,7 +18,7 @@ type CountriesResponse struct {
 }
 
 func (s Server) GetCountriesHandler(c *gin.Context) {
-	countries, err := s.storageService.GetAllCountries()
+	countries, err := s.storageService.GetAllCountries(c.Request.Context())
 	if err != nil {
 		InternalServerError(c, err)
 		return
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rawfish-dev/angrypros-api/config"
+)
+
+// Bounds how long services called with c.Request.Context() may take, a
+// timeout of zero leaves the request without a deadline
+func requestTimeoutMiddleware(sc config.ServerConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeoutSeconds := sc.RequestTimeoutSeconds
+		routeTimeoutSeconds, exists := sc.RouteRequestTimeoutSeconds[fmt.Sprintf("%s %s", c.Request.Method, c.FullPath())]
+		if exists {
+			timeoutSeconds = routeTimeoutSeconds
+		}
+
+		if timeoutSeconds <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(timeoutSeconds)*time.Second)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
@@ -1,15 +1,15 @@
 package handlers
 
 import (
-	"encoding/json"
 	"errors"
-	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/rawfish-dev/angrypros-api/config"
 	"github.com/rawfish-dev/angrypros-api/models"
+	"github.com/rawfish-dev/angrypros-api/services/screening"
 	"github.com/rawfish-dev/angrypros-api/services/storage"
 )
 
@@ -80,6 +80,8 @@ func (e EditUserRequest) validate(userConfig config.UserConfig) []error {
 
 type CurrentUserResponse struct {
 	UserResponse
+	Roles        []string        `json:"roles"`
+	FeatureFlags map[string]bool `json:"featureFlags"`
 }
 
 type UserResponse struct {
@@ -88,6 +90,10 @@ type UserResponse struct {
 	Country  CountryResponse `json:"country"`
 }
 
+type UsersResponse struct {
+	Users []UserResponse `json:"users"`
+}
+
 type ForgotPasswordRequest struct {
 	EmailAddress   string `json:"emailAddress"`
 	RecaptchaToken string `json:"recaptchaToken"`
@@ -107,33 +113,32 @@ func (s Server) CreateUserHandler(c *gin.Context) {
 		return
 	}
 
-	jsonReqData, err := ioutil.ReadAll(c.Request.Body)
-	if err != nil {
-		MalformedRequestError(c, err)
-		return
-	}
-
 	var req BaseUserRequest
-	err = json.Unmarshal(jsonReqData, &req)
-	if err != nil {
-		MalformedRequestError(c, err)
+	if !s.decodeJSONBody(c, &req) {
 		return
 	}
 
-	validationErrors := req.validate(s.config.UserConfig)
+	validationErrors := req.validate(s.settingsService.Current().UserConfig)
 	if validationErrors != nil {
 		UnprocessableRequestError(c, validationErrors)
 		return
 	}
 
+	usernameScreening := s.screeningService.Screen(c.Request.Context(), req.Username)
+	usernameErrors := screeningErrors("username", usernameScreening, false)
+	if usernameErrors != nil {
+		UnprocessableRequestError(c, usernameErrors)
+		return
+	}
+
 	firebaseUserId := c.MustGet("firebaseUserId").(string)
-	email, err := s.authService.GetFirebaseUserEmail(firebaseUserId)
+	email, err := s.authService.GetFirebaseUserEmail(c.Request.Context(), firebaseUserId)
 	if err != nil {
 		InternalServerError(c, err)
 		return
 	}
 
-	existingUser, err := s.storageService.GetUserByEmailAddress(email)
+	existingUser, err := s.storageService.GetUserByEmailAddress(c.Request.Context(), email)
 	if err != nil {
 		switch err.(type) {
 		case storage.GeneralDBError:
@@ -149,13 +154,15 @@ func (s Server) CreateUserHandler(c *gin.Context) {
 	}
 
 	// No transaction added to prevent complete conflicts for simplicity
-	user, err := s.storageService.CreateUser(firebaseUserId, req.Username,
+	user, err := s.storageService.CreateUser(c.Request.Context(), firebaseUserId, req.Username,
 		email, req.CountryIsoAlpha2Code)
 	if err != nil {
 		InternalServerError(c, err)
 		return
 	}
 
+	s.flagForModeration(c, models.ReportTargetTypeUser, user.Id, usernameScreening)
+
 	resp := buildMinimalUserResponse(*user)
 
 	WrapJSONAPI(c, http.StatusCreated, resp, nil, nil)
@@ -164,31 +171,41 @@ func (s Server) CreateUserHandler(c *gin.Context) {
 func (s Server) EditUserHandler(c *gin.Context) {
 	currentUser := c.MustGet("currentUser").(*models.User)
 
-	jsonReqData, err := ioutil.ReadAll(c.Request.Body)
-	if err != nil {
-		MalformedRequestError(c, err)
-		return
-	}
-
 	var req EditUserRequest
-	err = json.Unmarshal(jsonReqData, &req)
-	if err != nil {
-		MalformedRequestError(c, err)
+	if !s.decodeJSONBody(c, &req) {
 		return
 	}
 
-	validationErrors := req.validate(s.config.UserConfig)
+	validationErrors := req.validate(s.settingsService.Current().UserConfig)
 	if validationErrors != nil {
 		UnprocessableRequestError(c, validationErrors)
 		return
 	}
 
-	user, err := s.storageService.EditUser(*currentUser, req.Username, req.CountryIsoAlpha2Code)
+	// An unchanged username was screened when it was set, screening it again
+	// would raise a report on every profile edit
+	usernameChanged := req.Username != currentUser.Username
+
+	var usernameScreening screening.Result
+	if usernameChanged {
+		usernameScreening = s.screeningService.Screen(c.Request.Context(), req.Username)
+		usernameErrors := screeningErrors("username", usernameScreening, false)
+		if usernameErrors != nil {
+			UnprocessableRequestError(c, usernameErrors)
+			return
+		}
+	}
+
+	user, err := s.storageService.EditUser(c.Request.Context(), *currentUser, req.Username, req.CountryIsoAlpha2Code)
 	if err != nil {
 		InternalServerError(c, err)
 		return
 	}
 
+	if usernameChanged {
+		s.flagForModeration(c, models.ReportTargetTypeUser, user.Id, usernameScreening)
+	}
+
 	resp := buildMinimalUserResponse(*user)
 
 	WrapJSONAPI(c, http.StatusOK, resp, nil, nil)
@@ -197,22 +214,48 @@ func (s Server) EditUserHandler(c *gin.Context) {
 func (s Server) GetCurrentUserHandler(c *gin.Context) {
 	currentUser := c.MustGet("currentUser").(*models.User)
 
-	resp := buildCurrentUserResponse(*currentUser)
+	featureFlags := s.featureFlagService.Evaluate(c.Request.Context(), currentUser)
+
+	resp := buildCurrentUserResponse(*currentUser, featureFlags)
 
 	WrapJSONAPI(c, http.StatusOK, resp, nil, nil)
 }
 
-func (s Server) ForgotPasswordHandler(c *gin.Context) {
-	jsonReqData, err := ioutil.ReadAll(c.Request.Body)
+func (s Server) SearchUsersHandler(c *gin.Context) {
+	// Autocomplete is triggered from "@" mentions so allow the prefix through
+	query := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(c.Query("q")), "@"))
+	if len(query) == 0 {
+		WrapJSONAPI(c, http.StatusOK, UsersResponse{Users: []UserResponse{}}, nil, nil)
+		return
+	}
+
+	if cached, found := s.userSearchCache.get(c.Request.Context(), query); found {
+		WrapJSONAPI(c, http.StatusOK, cached, nil, nil)
+		return
+	}
+
+	users, err := s.storageService.SearchUsers(c.Request.Context(), query, s.settingsService.Current().UserConfig.SearchResultLimit)
 	if err != nil {
-		MalformedRequestError(c, err)
+		InternalServerError(c, err)
 		return
 	}
 
+	userResponses := make([]UserResponse, len(users))
+	for idx := range users {
+		userResponses[idx] = buildMinimalUserResponse(users[idx])
+	}
+
+	resp := UsersResponse{
+		Users: userResponses,
+	}
+	s.userSearchCache.set(c.Request.Context(), query, resp)
+
+	WrapJSONAPI(c, http.StatusOK, resp, nil, nil)
+}
+
+func (s Server) ForgotPasswordHandler(c *gin.Context) {
 	var req ForgotPasswordRequest
-	err = json.Unmarshal(jsonReqData, &req)
-	if err != nil {
-		MalformedRequestError(c, err)
+	if !s.decodeJSONBody(c, &req) {
 		return
 	}
 
@@ -242,9 +285,11 @@ func (s Server) ForgotPasswordHandler(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
-func buildCurrentUserResponse(user models.User) CurrentUserResponse {
+func buildCurrentUserResponse(user models.User, featureFlags map[string]bool) CurrentUserResponse {
 	return CurrentUserResponse{
 		UserResponse: buildMinimalUserResponse(user),
+		Roles:        user.RoleNames(),
+		FeatureFlags: featureFlags,
 	}
 }
 
@@ -1,38 +1,159 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"net/http"
+	"log/slog"
 	"os"
 
 	"github.com/rawfish-dev/angrypros-api/config"
 	"github.com/rawfish-dev/angrypros-api/handlers"
+	"github.com/rawfish-dev/angrypros-api/services/audit"
 	"github.com/rawfish-dev/angrypros-api/services/auth"
+	"github.com/rawfish-dev/angrypros-api/services/digest"
+	"github.com/rawfish-dev/angrypros-api/services/email"
+	"github.com/rawfish-dev/angrypros-api/services/featureflag"
+	"github.com/rawfish-dev/angrypros-api/services/logging"
+	"github.com/rawfish-dev/angrypros-api/services/metrics"
+	"github.com/rawfish-dev/angrypros-api/services/notification"
+	"github.com/rawfish-dev/angrypros-api/services/push"
+	"github.com/rawfish-dev/angrypros-api/services/ratelimit"
+	"github.com/rawfish-dev/angrypros-api/services/screening"
+	"github.com/rawfish-dev/angrypros-api/services/settings"
+	"github.com/rawfish-dev/angrypros-api/services/spam"
 	"github.com/rawfish-dev/angrypros-api/services/storage"
 	timeS "github.com/rawfish-dev/angrypros-api/services/time"
+	"github.com/rawfish-dev/angrypros-api/services/tracing"
 )
 
 func main() {
-	appConfig := config.NewAppConfig(os.Getenv("APP_ENVIRONMENT"), ".")
+	err := run(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	appConfig, err := config.NewAppConfig(os.Getenv("APP_ENVIRONMENT"), ".")
+	if err != nil {
+		return fmt.Errorf("could not load config due to %s", err)
+	}
 
-	authService, err := auth.NewService(appConfig.GoogleConfig)
+	logger, err := logging.New(appConfig.LoggingConfig, os.Stdout)
 	if err != nil {
-		panic(fmt.Sprintf("could not initialise auth service due to %s", err))
+		return fmt.Errorf("could not initialise logger due to %s", err)
 	}
+	// Also routes anything still using the standard log package through it
+	slog.SetDefault(logger)
+	slog.Info("loaded config", "environment", os.Getenv("APP_ENVIRONMENT"), "config", appConfig.Redacted())
 
-	storageService, err := storage.NewService(appConfig.PostgresConfig)
+	shutdownTracing, err := tracing.Setup(appConfig.TracingConfig)
 	if err != nil {
-		panic(fmt.Sprintf("could not initialise storage service due to %s", err))
+		return fmt.Errorf("could not initialise tracing due to %s", err)
+	}
+	defer func() {
+		err := shutdownTracing(context.Background())
+		if err != nil {
+			slog.Error("unable to flush traces", "error", err)
+		}
+	}()
+
+	appMetrics := metrics.New()
+
+	authService, err := auth.NewService(appConfig.GoogleConfig, appMetrics)
+	if err != nil {
+		return fmt.Errorf("could not initialise auth service due to %s", err)
+	}
+
+	storageService, err := storage.NewService(appConfig.PostgresConfig, metrics.NewGormPlugin(appMetrics),
+		tracing.NewGormPlugin())
+	if err != nil {
+		return fmt.Errorf("could not initialise storage service due to %s", err)
+	}
+	defer func() {
+		err := storageService.Close()
+		if err != nil {
+			slog.Error("unable to close storage service", "error", err)
+		}
+	}()
+
+	auditService := audit.NewService(storageService)
+
+	if len(args) > 0 {
+		return runCommand(context.Background(), args, authService, storageService, auditService)
+	}
+
+	sqlDB, err := storageService.SQLDB()
+	if err != nil {
+		return fmt.Errorf("could not access connection pool due to %s", err)
+	}
+
+	err = appMetrics.RegisterDBStats(sqlDB, appConfig.PostgresConfig.Database)
+	if err != nil {
+		return fmt.Errorf("could not register connection pool metrics due to %s", err)
 	}
 
 	timeService := timeS.NewService()
 
-	server, err := handlers.NewServer(appConfig, authService,
-		storageService, timeService)
+	pushDispatcher, err := push.NewFCMDispatcher(appConfig.GoogleConfig)
+	if err != nil {
+		return fmt.Errorf("could not initialise push dispatcher due to %s", err)
+	}
+
+	notificationService := notification.NewService(storageService, pushDispatcher)
+	// Deferred after storage so pending pushes finish before it is closed
+	defer notificationService.Stop()
+
+	emailService := email.NewService(appConfig.EmailConfig)
+
+	settingsService, err := settings.NewService(appConfig, os.Getenv("APP_ENVIRONMENT"), ".", timeService)
+	if err != nil {
+		return fmt.Errorf("could not initialise settings service due to %s", err)
+	}
+
+	digestService, err := digest.NewService(settingsService, storageService,
+		emailService, timeService)
+	if err != nil {
+		return fmt.Errorf("could not initialise digest service due to %s", err)
+	}
+
+	screeningService, err := screening.NewService(appConfig.ScreeningConfig)
 	if err != nil {
-		panic(fmt.Sprintf("could not initialise server due to %s", err))
+		return fmt.Errorf("could not initialise screening service due to %s", err)
+	}
+
+	var rateLimitStore ratelimit.Store
+	switch appConfig.RateLimitConfig.Store {
+	case ratelimit.StorePostgres:
+		rateLimitStore = ratelimit.NewPostgresStore(storageService)
+	default:
+		rateLimitStore = ratelimit.NewMemoryStore()
 	}
 
-	server.SetupRoutes()
-	http.ListenAndServe(":8080", server)
+	rateLimiter := ratelimit.NewService(settingsService, rateLimitStore, timeService)
+
+	spamService := spam.NewService(settingsService, storageService, timeService)
+
+	featureFlagService := featureflag.NewService(settingsService)
+
+	server, err := handlers.NewServer(appConfig, settingsService, authService,
+		storageService, timeService, notificationService, screeningService, auditService,
+		rateLimiter, spamService, featureFlagService, appMetrics)
+	if err != nil {
+		return fmt.Errorf("could not initialise server due to %s", err)
+	}
+
+	err = server.SetupRoutes()
+	if err != nil {
+		return fmt.Errorf("could not set up routes due to %s", err)
+	}
+
+	settingsService.Start()
+	defer settingsService.Stop()
+
+	digestService.Start()
+	defer digestService.Stop()
+
+	return serve(appConfig.ServerConfig, server, appMetrics)
 }
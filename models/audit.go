@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+)
+
+type AuditAction string
+
+const (
+	AuditActionBootstrapAdmin  AuditAction = "bootstrap-admin"
+	AuditActionEditUserRoles   AuditAction = "edit-user-roles"
+	AuditActionClaimReport     AuditAction = "claim-report"
+	AuditActionResolveReport   AuditAction = "resolve-report"
+	AuditActionDismissReport   AuditAction = "dismiss-report"
+	AuditActionSuspendUser     AuditAction = "suspend-user"
+	AuditActionUnsuspendUser   AuditAction = "unsuspend-user"
+	AuditActionShadowbanUser   AuditAction = "shadowban-user"
+	AuditActionUnshadowbanUser AuditAction = "unshadowban-user"
+)
+
+type AuditTargetType string
+
+const (
+	AuditTargetTypeUser   AuditTargetType = "user"
+	AuditTargetTypeReport AuditTargetType = "report"
+)
+
+// Append only, updates and deletes are rejected by a database trigger.
+// Snapshots are JSON documents and a nil actor means the system acted
+type AuditLogEntry struct {
+	Id         int64
+	Action     AuditAction     `gorm:"not null"`
+	TargetType AuditTargetType `gorm:"index:idx_audit_log_target;not null"`
+	TargetId   int64           `gorm:"index:idx_audit_log_target;not null"`
+	Before     *string         `gorm:"type:jsonb"`
+	After      *string         `gorm:"type:jsonb"`
+	RequestId  string
+	CreatedAt  time.Time `gorm:"index"`
+
+	// References
+	ActorUserId *int64 `gorm:"index"`
+	Actor       *User  `gorm:"foreignKey:ActorUserId"`
+}
+
+func (AuditLogEntry) TableName() string {
+	return "audit_log"
+}
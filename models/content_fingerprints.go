@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// Hash of the normalised text of a submission, used to spot the same content
+// being posted repeatedly and to measure how quickly a user is posting
+type ContentFingerprint struct {
+	Id        int64
+	Hash      string    `gorm:"index:idx_content_fingerprints_hash_created_at"`
+	CreatedAt time.Time `gorm:"index:idx_content_fingerprints_hash_created_at;index:idx_content_fingerprints_user_created_at"`
+
+	// References
+	UserId int64 `gorm:"index:idx_content_fingerprints_user_created_at;not null"`
+	User   User  `gorm:"foreignKey:UserId"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+type DevicePlatform string
+
+const (
+	DevicePlatformAndroid DevicePlatform = "android"
+	DevicePlatformIOS     DevicePlatform = "ios"
+	DevicePlatformWeb     DevicePlatform = "web"
+)
+
+var (
+	DevicePlatforms = []DevicePlatform{
+		DevicePlatformAndroid,
+		DevicePlatformIOS,
+		DevicePlatformWeb,
+	}
+)
+
+type DeviceToken struct {
+	Id        int64
+	Token     string         `gorm:"uniqueindex;not null"`
+	Platform  DevicePlatform `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// References
+	UserId int64 `gorm:"index;not null"`
+	User   User  `gorm:"foreignKey:UserId"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+)
+
+type DigestFrequency string
+
+const (
+	DigestFrequencyNone   DigestFrequency = "none"
+	DigestFrequencyDaily  DigestFrequency = "daily"
+	DigestFrequencyWeekly DigestFrequency = "weekly"
+)
+
+var (
+	DigestFrequencies = []DigestFrequency{
+		DigestFrequencyNone,
+		DigestFrequencyDaily,
+		DigestFrequencyWeekly,
+	}
+)
+
+// Absence of a preference means the configured default digest frequency
+// applies
+type EmailPreference struct {
+	UserId          int64           `gorm:"primaryKey"`
+	DigestFrequency DigestFrequency `gorm:"not null"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+type EmailDigestStatus string
+
+const (
+	EmailDigestStatusPending EmailDigestStatus = "pending"
+	EmailDigestStatusSent    EmailDigestStatus = "sent"
+	EmailDigestStatusSkipped EmailDigestStatus = "skipped"
+)
+
+// One row per user per digest period, the unique index is what prevents a
+// digest from being sent twice
+type EmailDigest struct {
+	Id                int64
+	Frequency         DigestFrequency   `gorm:"uniqueindex:idx_email_digests_period;not null"`
+	PeriodStart       time.Time         `gorm:"uniqueindex:idx_email_digests_period;not null"`
+	PeriodEnd         time.Time         `gorm:"not null"`
+	Status            EmailDigestStatus `gorm:"not null"`
+	NotificationCount int               `gorm:"not null"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+
+	// References
+	UserId int64 `gorm:"uniqueindex:idx_email_digests_period;not null"`
+	User   User  `gorm:"foreignKey:UserId"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+)
+
+type NotificationType string
+
+const (
+	NotificationTypeComment  NotificationType = "comment"
+	NotificationTypeReply    NotificationType = "reply"
+	NotificationTypeReaction NotificationType = "reaction"
+	NotificationTypeMention  NotificationType = "mention"
+	NotificationTypeFollow   NotificationType = "follow"
+)
+
+var (
+	NotificationTypes = []NotificationType{
+		NotificationTypeComment,
+		NotificationTypeReply,
+		NotificationTypeReaction,
+		NotificationTypeMention,
+		NotificationTypeFollow,
+	}
+)
+
+type NotificationTargetType string
+
+const (
+	NotificationTargetTypeEntry   NotificationTargetType = "entry"
+	NotificationTargetTypeComment NotificationTargetType = "comment"
+	NotificationTargetTypeUser    NotificationTargetType = "user"
+)
+
+// Unread notifications of the same type on the same target are aggregated
+// into a single row, with ActorCount tracking the distinct actors involved
+type Notification struct {
+	Id         int64
+	Type       NotificationType       `gorm:"not null"`
+	TargetType NotificationTargetType `gorm:"not null"`
+	TargetId   int64                  `gorm:"not null"`
+	ActorCount int                    `gorm:"not null;default:1"`
+	ReadAt     *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time `gorm:"index"`
+
+	// References
+	RecipientUserId   int64 `gorm:"index;not null"`
+	Recipient         User  `gorm:"foreignKey:RecipientUserId"`
+	LatestActorUserId int64 `gorm:"not null"`
+	LatestActor       User  `gorm:"foreignKey:LatestActorUserId"`
+}
+
+type NotificationActor struct {
+	NotificationId int64 `gorm:"primaryKey"`
+	ActorUserId    int64 `gorm:"primaryKey"`
+	CreatedAt      time.Time
+}
+
+// Absence of a preference for a notification type means it is enabled
+type NotificationPreference struct {
+	UserId           int64            `gorm:"primaryKey"`
+	NotificationType NotificationType `gorm:"primaryKey"`
+	PushEnabled      bool             `gorm:"not null"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
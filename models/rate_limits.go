@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// Token bucket state shared between instances, Allowed records the outcome
+// of the most recent take so it can be returned from the same statement
+type RateLimitBucket struct {
+	Key       string  `gorm:"primaryKey"`
+	Tokens    float64 `gorm:"not null"`
+	Allowed   bool    `gorm:"not null"`
+	UpdatedAt time.Time
+}
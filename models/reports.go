@@ -0,0 +1,115 @@
+package models
+
+import (
+	"time"
+)
+
+type ReportTargetType string
+
+const (
+	ReportTargetTypeUser ReportTargetType = "user"
+)
+
+var (
+	ReportTargetTypes = []ReportTargetType{
+		ReportTargetTypeUser,
+	}
+)
+
+type ReportReason string
+
+const (
+	ReportReasonSpam                ReportReason = "spam"
+	ReportReasonHarassment          ReportReason = "harassment"
+	ReportReasonHateSpeech          ReportReason = "hate-speech"
+	ReportReasonPersonalInformation ReportReason = "personal-information"
+	ReportReasonOther               ReportReason = "other"
+
+	// Raised by the system rather than a user so not selectable when reporting
+	ReportReasonAutomated ReportReason = "automated"
+)
+
+var (
+	ReportReasons = []ReportReason{
+		ReportReasonSpam,
+		ReportReasonHarassment,
+		ReportReasonHateSpeech,
+		ReportReasonPersonalInformation,
+		ReportReasonOther,
+	}
+)
+
+type ReportStatus string
+
+const (
+	ReportStatusOpen      ReportStatus = "open"
+	ReportStatusClaimed   ReportStatus = "claimed"
+	ReportStatusResolved  ReportStatus = "resolved"
+	ReportStatusDismissed ReportStatus = "dismissed"
+)
+
+var (
+	ReportStatuses = []ReportStatus{
+		ReportStatusOpen,
+		ReportStatusClaimed,
+		ReportStatusResolved,
+		ReportStatusDismissed,
+	}
+)
+
+type ModerationAction string
+
+const (
+	ModerationActionHide      ModerationAction = "hide"
+	ModerationActionDelete    ModerationAction = "delete"
+	ModerationActionWarn      ModerationAction = "warn"
+	ModerationActionSuspend   ModerationAction = "suspend"
+	ModerationActionShadowban ModerationAction = "shadowban"
+)
+
+var (
+	ModerationActions = []ModerationAction{
+		ModerationActionHide,
+		ModerationActionDelete,
+		ModerationActionWarn,
+		ModerationActionSuspend,
+		ModerationActionShadowban,
+	}
+)
+
+// Each user may only report a given target once, which is what makes the
+// report count a count of distinct reporters. Details are optionally given
+// by the reporter, automated reports have no reporter and describe what was
+// detected in Details
+type Report struct {
+	Id               int64
+	TargetType       ReportTargetType `gorm:"uniqueindex:idx_reports_reporter_target;index:idx_reports_target;not null"`
+	TargetId         int64            `gorm:"uniqueindex:idx_reports_reporter_target;index:idx_reports_target;not null"`
+	Reason           ReportReason     `gorm:"not null"`
+	Details          string
+	Status           ReportStatus `gorm:"index;not null"`
+	ResolutionAction *ModerationAction
+	ClaimedAt        *time.Time
+	ClosedAt         *time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+
+	// References
+	ReporterUserId  *int64 `gorm:"uniqueindex:idx_reports_reporter_target"`
+	Reporter        *User  `gorm:"foreignKey:ReporterUserId"`
+	ModeratorUserId *int64
+	Moderator       *User `gorm:"foreignKey:ModeratorUserId"`
+}
+
+type UserWarning struct {
+	Id        int64
+	Reason    string `gorm:"not null"`
+	CreatedAt time.Time
+
+	// References
+	UserId          int64 `gorm:"index;not null"`
+	User            User  `gorm:"foreignKey:UserId"`
+	ModeratorUserId int64 `gorm:"not null"`
+	Moderator       User  `gorm:"foreignKey:ModeratorUserId"`
+	ReportId        *int64
+}
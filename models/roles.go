@@ -0,0 +1,108 @@
+package models
+
+import (
+	"time"
+)
+
+type Role string
+
+const (
+	RoleAdmin     Role = "admin"
+	RoleModerator Role = "moderator"
+)
+
+var (
+	Roles = []Role{
+		RoleAdmin,
+		RoleModerator,
+	}
+)
+
+type Permission string
+
+const (
+	PermissionModerateReports Permission = "moderate-reports"
+	PermissionModerateUsers   Permission = "moderate-users"
+	PermissionManageRoles     Permission = "manage-roles"
+	PermissionReadAuditLog    Permission = "read-audit-log"
+)
+
+// Permissions are granted through roles only and live in code so that
+// changing what a role can do does not require a data migration
+var (
+	rolePermissions = map[Role][]Permission{
+		RoleAdmin: {
+			PermissionModerateReports,
+			PermissionModerateUsers,
+			PermissionManageRoles,
+			PermissionReadAuditLog,
+		},
+		RoleModerator: {
+			PermissionModerateReports,
+			PermissionModerateUsers,
+		},
+	}
+)
+
+// Higher ranked roles cannot be moderated by lower or equally ranked ones
+var (
+	roleRanks = map[Role]int{
+		RoleAdmin:     2,
+		RoleModerator: 1,
+	}
+)
+
+type UserRole struct {
+	UserId    int64 `gorm:"primaryKey"`
+	Role      Role  `gorm:"primaryKey"`
+	CreatedAt time.Time
+}
+
+func (u User) HasPermission(permission Permission) bool {
+	for _, userRole := range u.Roles {
+		for _, rolePermission := range rolePermissions[userRole.Role] {
+			if rolePermission == permission {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (u User) HasRole(role Role) bool {
+	for _, userRole := range u.Roles {
+		if userRole.Role == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Rank of the highest role held, zero for users without a role
+func (u User) RoleRank() int {
+	var rank int
+	for _, userRole := range u.Roles {
+		if roleRanks[userRole.Role] > rank {
+			rank = roleRanks[userRole.Role]
+		}
+	}
+
+	return rank
+}
+
+// Users cannot moderate themselves or anyone holding a role at or above
+// their own
+func (u User) CanModerate(target User) bool {
+	return u.Id != target.Id && target.RoleRank() < u.RoleRank()
+}
+
+func (u User) RoleNames() []string {
+	roleNames := make([]string, len(u.Roles))
+	for idx := range u.Roles {
+		roleNames[idx] = string(u.Roles[idx].Role)
+	}
+
+	return roleNames
+}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type User struct {
@@ -12,10 +14,18 @@ type User struct {
 	NormalisedEmailAddress string `gorm:"uniqueindex;not null"`
 	CreatedAt              time.Time
 	UpdatedAt              time.Time
+	DeletedAt              gorm.DeletedAt `gorm:"index"`
+
+	// Moderation
+	HiddenAt         *time.Time
+	SuspendedUntil   *time.Time
+	SuspensionReason string
+	ShadowbannedAt   *time.Time
 
 	// References
-	CountryIsoAlpha2Code string  `gorm:"not null"`
-	Country              Country `gorm:"foreignKey:CountryIsoAlpha2Code"`
+	CountryIsoAlpha2Code string     `gorm:"not null"`
+	Country              Country    `gorm:"foreignKey:CountryIsoAlpha2Code"`
+	Roles                []UserRole `gorm:"foreignKey:UserId"`
 }
 
 type Country struct {
@@ -24,3 +34,7 @@ type Country struct {
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 }
+
+func (u User) IsSuspended(now time.Time) bool {
+	return u.SuspendedUntil != nil && u.SuspendedUntil.After(now)
+}
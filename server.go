@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rawfish-dev/angrypros-api/config"
+	"github.com/rawfish-dev/angrypros-api/handlers"
+	"github.com/rawfish-dev/angrypros-api/services/metrics"
+)
+
+const (
+	defaultPort                     = 8080
+	defaultMetricsPort              = 9090
+	defaultReadTimeoutSeconds       = 15
+	defaultReadHeaderTimeoutSeconds = 5
+	defaultWriteTimeoutSeconds      = 30
+	defaultIdleTimeoutSeconds       = 120
+	defaultMaxHeaderBytes           = 1 << 20
+	defaultShutdownTimeoutSeconds   = 20
+)
+
+func newHTTPServer(sc config.ServerConfig, port int, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           handler,
+		ReadTimeout:       secondsOrDefault(sc.ReadTimeoutSeconds, defaultReadTimeoutSeconds),
+		ReadHeaderTimeout: secondsOrDefault(sc.ReadHeaderTimeoutSeconds, defaultReadHeaderTimeoutSeconds),
+		WriteTimeout:      secondsOrDefault(sc.WriteTimeoutSeconds, defaultWriteTimeoutSeconds),
+		IdleTimeout:       secondsOrDefault(sc.IdleTimeoutSeconds, defaultIdleTimeoutSeconds),
+		MaxHeaderBytes:    valueOrDefault(sc.MaxHeaderBytes, defaultMaxHeaderBytes),
+	}
+}
+
+// Serves the API and the internal metrics listener until SIGINT or SIGTERM
+// is received, then fails readiness, stops accepting new connections and
+// waits for in-flight requests to finish
+func serve(sc config.ServerConfig, server *handlers.Server, m *metrics.Metrics) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", m.Handler())
+
+	httpServers := []*http.Server{
+		newHTTPServer(sc, valueOrDefault(sc.Port, defaultPort), server),
+		newHTTPServer(sc, valueOrDefault(sc.MetricsPort, defaultMetricsPort), metricsMux),
+	}
+
+	serveErr := make(chan error, len(httpServers))
+	for _, httpServer := range httpServers {
+		go func(httpServer *http.Server) {
+			slog.Info("listening", "address", httpServer.Addr)
+			serveErr <- httpServer.ListenAndServe()
+		}(httpServer)
+	}
+
+	var err error
+	select {
+	case err = <-serveErr:
+		err = fmt.Errorf("could not serve due to %s", err)
+	case <-ctx.Done():
+		// A second signal terminates immediately
+		stop()
+
+		server.MarkShuttingDown()
+
+		if sc.ShutdownDelaySeconds > 0 {
+			slog.Info("shutting down, failing readiness before draining", "delay_seconds", sc.ShutdownDelaySeconds)
+			time.Sleep(time.Duration(sc.ShutdownDelaySeconds) * time.Second)
+		}
+
+		slog.Info("shutting down, draining connections")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(),
+		secondsOrDefault(sc.ShutdownTimeoutSeconds, defaultShutdownTimeoutSeconds))
+	defer cancel()
+
+	for _, httpServer := range httpServers {
+		shutdownErr := httpServer.Shutdown(shutdownCtx)
+		if shutdownErr != nil && err == nil {
+			err = fmt.Errorf("could not shut down cleanly due to %s", shutdownErr)
+		}
+	}
+
+	return err
+}
+
+func valueOrDefault(value, defaultValue int) int {
+	if value <= 0 {
+		return defaultValue
+	}
+
+	return value
+}
+
+func secondsOrDefault(seconds, defaultSeconds int) time.Duration {
+	return time.Duration(valueOrDefault(seconds, defaultSeconds)) * time.Second
+}
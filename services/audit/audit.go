@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+	"github.com/rawfish-dev/angrypros-api/services/storage"
+)
+
+// Records moderator and admin actions in the audit log within the same
+// transaction as the action itself, so an action is never applied without
+// its audit entry or vice versa
+
+var _ AuditService = new(Service)
+
+type AuditService interface {
+	Perform(ctx context.Context, entry Entry, action Action) error
+}
+
+// ActorUserId is nil when the system performs the action
+type Entry struct {
+	ActorUserId *int64
+	Action      models.AuditAction
+	TargetType  models.AuditTargetType
+	TargetId    int64
+	RequestId   string
+}
+
+// Receives a transaction bound storage service to perform the action with
+// and returns JSON serialisable snapshots of the target before and after
+type Action func(tx storage.StorageService) (before, after interface{}, err error)
+
+type Service struct {
+	storageService storage.StorageService
+}
+
+func NewService(s storage.StorageService) *Service {
+	return &Service{
+		storageService: s,
+	}
+}
+
+func (s Service) Perform(ctx context.Context, entry Entry, action Action) error {
+	return s.storageService.Transaction(ctx, func(tx storage.StorageService) error {
+		before, after, err := action(tx)
+		if err != nil {
+			return err
+		}
+
+		beforeSnapshot, err := marshalSnapshot(before)
+		if err != nil {
+			return err
+		}
+
+		afterSnapshot, err := marshalSnapshot(after)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateAuditLogEntry(ctx, models.AuditLogEntry{
+			Action:      entry.Action,
+			TargetType:  entry.TargetType,
+			TargetId:    entry.TargetId,
+			Before:      beforeSnapshot,
+			After:       afterSnapshot,
+			RequestId:   entry.RequestId,
+			ActorUserId: entry.ActorUserId,
+		})
+
+		return err
+	})
+}
+
+func marshalSnapshot(snapshot interface{}) (*string, error) {
+	if snapshot == nil {
+		return nil, nil
+	}
+
+	snapshotBytes, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal audit snapshot due to %s", err)
+	}
+
+	snapshotString := string(snapshotBytes)
+
+	return &snapshotString, nil
+}
@@ -4,21 +4,37 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"time"
 
 	firebase "firebase.google.com/go/v4"
 	"firebase.google.com/go/v4/auth"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/api/option"
 
 	"github.com/rawfish-dev/angrypros-api/config"
+	"github.com/rawfish-dev/angrypros-api/services/logging"
+	"github.com/rawfish-dev/angrypros-api/services/metrics"
+)
+
+const (
+	customClaimRoles = "roles"
+)
+
+var (
+	tracer = otel.Tracer("github.com/rawfish-dev/angrypros-api/services/auth")
 )
 
 var _ AuthService = new(Service)
 
 type AuthService interface {
-	CreateFirebaseUser(emailAddress, username, password string) (firebaseUserId string, err error)
-	GetFirebaseUserId(idToken string) (firebaseUserId string, err error)
-	GetFirebaseUserEmail(firebaseUserId string) (email string, err error)
+	CreateFirebaseUser(ctx context.Context, emailAddress, username, password string) (firebaseUserId string, err error)
+	GetFirebaseUserId(ctx context.Context, idToken string) (firebaseUserId string, err error)
+	GetFirebaseUserEmail(ctx context.Context, firebaseUserId string) (email string, err error)
+	SetFirebaseUserRoles(ctx context.Context, firebaseUserId string, roles []string) (err error)
+	// Confirms the public keys used to verify id tokens can be loaded
+	CheckKeySet(ctx context.Context) (err error)
 	// VerifyRecaptcha(recaptchaToken string) (err error)
 	// SendForgotPasswordEmail(email string) (err error)
 }
@@ -37,12 +53,14 @@ type GoogleRecaptchaResponse struct {
 
 type Service struct {
 	firebaseApp               *firebase.App
+	keySet                    *keySetCache
+	metrics                   *metrics.Metrics
 	skipRecaptchaVerification bool
 	// recaptchaVerificationUrl  string
 	// recaptchaSecret           string
 }
 
-func NewService(g config.GoogleConfig) (*Service, error) {
+func NewService(g config.GoogleConfig, m *metrics.Metrics) (*Service, error) {
 	googleConfigBytes, err := json.Marshal(g)
 	if err != nil {
 		return nil, fmt.Errorf("could not marshal google config to bytes due to %s", err)
@@ -56,6 +74,8 @@ func NewService(g config.GoogleConfig) (*Service, error) {
 
 	s := &Service{
 		firebaseApp:               firebaseApp,
+		keySet:                    newKeySetCache(),
+		metrics:                   m,
 		skipRecaptchaVerification: true,
 		// skipRecaptchaVerification: r.SkipVerification,
 		// recaptchaVerificationUrl:  r.VerificationUrl,
@@ -65,12 +85,14 @@ func NewService(g config.GoogleConfig) (*Service, error) {
 	return s, nil
 }
 
-func (s Service) CreateFirebaseUser(emailAddress, username, password string) (string, error) {
-	ctx := context.Background()
+func (s Service) CreateFirebaseUser(ctx context.Context, emailAddress, username, password string) (string, error) {
+	ctx, span := tracer.Start(ctx, "auth.CreateFirebaseUser")
+	defer span.End()
 
 	authClient, err := s.firebaseApp.Auth(ctx)
 	if err != nil {
-		log.Printf("encountered error while creating Firebase auth client due to %s", err)
+		logging.FromContext(ctx).Error("encountered error while creating Firebase auth client", "error", err)
+		recordSpanError(span, err)
 		return "", err
 	}
 
@@ -80,7 +102,8 @@ func (s Service) CreateFirebaseUser(emailAddress, username, password string) (st
 		Password(password)
 	firebaseUser, err := authClient.CreateUser(ctx, params)
 	if err != nil {
-		log.Printf("encountered error while creating Firebase user due to %s", err)
+		logging.FromContext(ctx).Error("encountered error while creating Firebase user", "error", err)
+		recordSpanError(span, err)
 		return "", err
 	}
 
@@ -94,42 +117,77 @@ func (s Service) CreateFirebaseUser(emailAddress, username, password string) (st
 	return firebaseUser.UID, nil
 }
 
-func (s Service) GetFirebaseUserId(idToken string) (string, error) {
-	ctx := context.Background()
+func (s Service) GetFirebaseUserId(ctx context.Context, idToken string) (string, error) {
+	ctx, span := tracer.Start(ctx, "auth.GetFirebaseUserId")
+	defer span.End()
 
 	authClient, err := s.firebaseApp.Auth(ctx)
 	if err != nil {
-		log.Printf("encountered error while creating Firebase auth client due to %s", err)
+		logging.FromContext(ctx).Error("encountered error while creating Firebase auth client", "error", err)
+		s.metrics.ObserveTokenVerification(metrics.TokenVerificationError)
+		recordSpanError(span, err)
 		return "", err
 	}
 
 	token, err := authClient.VerifyIDToken(ctx, idToken)
 	if err != nil {
-		log.Printf("unable to verify id token with Firebase due to %s", err)
+		logging.FromContext(ctx).Info("unable to verify id token with Firebase", "error", err)
+		s.metrics.ObserveTokenVerification(tokenVerificationOutcome(err))
+		recordSpanError(span, err)
 		return "", err
 	}
 
+	s.metrics.ObserveTokenVerification(metrics.TokenVerificationValid)
+
 	return token.UID, nil
 }
 
-func (s Service) GetFirebaseUserEmail(firebaseUserId string) (email string, err error) {
-	ctx := context.Background()
+func (s Service) GetFirebaseUserEmail(ctx context.Context, firebaseUserId string) (email string, err error) {
+	ctx, span := tracer.Start(ctx, "auth.GetFirebaseUserEmail")
+	defer span.End()
 
 	authClient, err := s.firebaseApp.Auth(ctx)
 	if err != nil {
-		log.Printf("encountered error while creating Firebase auth client due to %s", err)
+		logging.FromContext(ctx).Error("encountered error while creating Firebase auth client", "error", err)
+		recordSpanError(span, err)
 		return "", err
 	}
 
 	firebaseUser, err := authClient.GetUser(ctx, firebaseUserId)
 	if err != nil {
-		log.Printf("unable to fetch Firebase user due to %s", err)
+		logging.FromContext(ctx).Error("unable to fetch Firebase user", "firebase_user_id", firebaseUserId, "error", err)
+		recordSpanError(span, err)
 		return "", err
 	}
 
 	return firebaseUser.Email, nil
 }
 
+// Roles are mirrored into custom claims so they are visible in the id token
+// after the client next refreshes it
+func (s Service) SetFirebaseUserRoles(ctx context.Context, firebaseUserId string, roles []string) error {
+	ctx, span := tracer.Start(ctx, "auth.SetFirebaseUserRoles")
+	defer span.End()
+
+	authClient, err := s.firebaseApp.Auth(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("encountered error while creating Firebase auth client", "error", err)
+		recordSpanError(span, err)
+		return err
+	}
+
+	err = authClient.SetCustomUserClaims(ctx, firebaseUserId, map[string]interface{}{
+		customClaimRoles: roles,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("unable to set Firebase custom claims", "firebase_user_id", firebaseUserId, "error", err)
+		recordSpanError(span, err)
+		return err
+	}
+
+	return nil
+}
+
 // func (s Service) VerifyRecaptcha(recaptchaToken string) (err error) {
 // 	if s.skipRecaptchaVerification {
 // 		return nil
@@ -177,7 +235,7 @@ func (s Service) SendForgotPasswordEmail(email string) (err error) {
 
 	// authClient, err := s.firebaseApp.Auth(ctx)
 	// if err != nil {
-	// 	log.Printf("encountered error while creating Firebase auth client due to %s", err)
+	// 	logging.FromContext(ctx).Error("encountered error while creating Firebase auth client", "error", err)
 	// 	return err
 	// }
 
@@ -185,3 +243,32 @@ func (s Service) SendForgotPasswordEmail(email string) (err error) {
 
 	return nil
 }
+
+func (s Service) CheckKeySet(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "auth.CheckKeySet")
+	defer span.End()
+
+	err := s.keySet.check(ctx, time.Now())
+	if err != nil {
+		recordSpanError(span, err)
+		return err
+	}
+
+	return nil
+}
+
+func tokenVerificationOutcome(err error) string {
+	switch {
+	case auth.IsIDTokenExpired(err):
+		return metrics.TokenVerificationExpired
+	case auth.IsIDTokenInvalid(err):
+		return metrics.TokenVerificationInvalid
+	}
+
+	return metrics.TokenVerificationError
+}
+
+func recordSpanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
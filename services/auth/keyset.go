@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// The same certificates the Firebase SDK verifies id tokens against
+	idTokenCertUrl = "https://www.googleapis.com/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com"
+
+	keySetFetchTimeout = 5 * time.Second
+	// Failed fetches are remembered for this long so repeated readiness
+	// probes do not each wait on an unreachable endpoint
+	keySetFailureCacheDuration = 30 * time.Second
+	// Used when the response has no usable max-age so probes do not fetch on
+	// every call, Google normally sends several hours
+	keySetMinimumMaxAge = 5 * time.Minute
+)
+
+var (
+	maxAgeRegex = regexp.MustCompile(`max-age=(\d+)`)
+
+	errKeySetFetchInProgress = errors.New("key set has not been fetched yet")
+)
+
+// Returned when the key set could not be refreshed but the previously
+// fetched one has not expired, so id tokens can still be verified
+type KeySetStaleError struct {
+	Err error
+}
+
+func (k KeySetStaleError) Error() string {
+	return fmt.Sprintf("key set could not be refreshed due to %s", k.Err)
+}
+
+func (k KeySetStaleError) Unwrap() error {
+	return k.Err
+}
+
+// Remembers whether the public key set could be loaded. The set is fetched
+// again halfway through its lifetime so a failed refresh is noticed while
+// the previous set is still usable
+type keySetCache struct {
+	mu     sync.Mutex
+	client *http.Client
+
+	fetching    bool
+	refreshAt   time.Time
+	expiresAt   time.Time
+	lastErr     error
+	failedUntil time.Time
+}
+
+func newKeySetCache() *keySetCache {
+	return &keySetCache{
+		client: &http.Client{Timeout: keySetFetchTimeout},
+	}
+}
+
+// The lock is only held to read and update the cached state, concurrent
+// callers get the cached result rather than waiting on an in-flight fetch
+func (k *keySetCache) check(ctx context.Context, now time.Time) error {
+	k.mu.Lock()
+	if now.Before(k.refreshAt) {
+		k.mu.Unlock()
+		return nil
+	}
+	if k.fetching || now.Before(k.failedUntil) {
+		err := k.cachedResult(now)
+		k.mu.Unlock()
+		return err
+	}
+	k.fetching = true
+	k.mu.Unlock()
+
+	maxAge, err := k.fetch(ctx)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.fetching = false
+	if err != nil {
+		k.lastErr = err
+		k.failedUntil = now.Add(keySetFailureCacheDuration)
+		return k.cachedResult(now)
+	}
+
+	k.lastErr = nil
+	k.failedUntil = time.Time{}
+	k.refreshAt = now.Add(maxAge / 2)
+	k.expiresAt = now.Add(maxAge)
+
+	return nil
+}
+
+// Must be called with the lock held
+func (k *keySetCache) cachedResult(now time.Time) error {
+	lastErr := k.lastErr
+	if lastErr == nil {
+		lastErr = errKeySetFetchInProgress
+	}
+
+	if now.Before(k.expiresAt) {
+		if k.lastErr == nil {
+			// A refresh is in flight and the current set is still valid
+			return nil
+		}
+		return KeySetStaleError{Err: lastErr}
+	}
+
+	return lastErr
+}
+
+// Returns how long the key set may be cached for
+func (k *keySetCache) fetch(ctx context.Context) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, idTokenCertUrl, nil)
+	if err != nil {
+		return 0, fmt.Errorf("unable to build key set request due to %s", err)
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("unable to fetch key set due to %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unable to fetch key set, received status %d", resp.StatusCode)
+	}
+
+	var keys map[string]string
+	err = json.NewDecoder(resp.Body).Decode(&keys)
+	if err != nil {
+		return 0, fmt.Errorf("unable to decode key set due to %s", err)
+	}
+	if len(keys) == 0 {
+		return 0, fmt.Errorf("key set is empty")
+	}
+
+	maxAge := 0
+	matches := maxAgeRegex.FindStringSubmatch(resp.Header.Get("Cache-Control"))
+	if matches != nil {
+		maxAge, _ = strconv.Atoi(matches[1])
+	}
+
+	if time.Duration(maxAge)*time.Second < keySetMinimumMaxAge {
+		return keySetMinimumMaxAge, nil
+	}
+
+	return time.Duration(maxAge) * time.Second, nil
+}
@@ -0,0 +1,261 @@
+package digest
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"html/template"
+	"time"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+	"github.com/rawfish-dev/angrypros-api/services/email"
+	"github.com/rawfish-dev/angrypros-api/services/logging"
+	"github.com/rawfish-dev/angrypros-api/services/notification"
+	"github.com/rawfish-dev/angrypros-api/services/settings"
+	"github.com/rawfish-dev/angrypros-api/services/storage"
+	timeS "github.com/rawfish-dev/angrypros-api/services/time"
+)
+
+// Background job that periodically emails users a summary of unread
+// notifications according to their digest frequency preference
+
+const (
+	defaultCheckInterval            = time.Hour
+	defaultMaximumNotificationCount = 10
+	userBatchSize                   = 100
+	// Claims still pending after this long are assumed to belong to a run
+	// that died part way and are taken over
+	pendingClaimTimeout = 30 * time.Minute
+)
+
+//go:embed templates/digest.html
+var templateFS embed.FS
+
+type digestTemplateData struct {
+	Username       string
+	Frequency      models.DigestFrequency
+	PeriodLabel    string
+	Summaries      []string
+	MoreCount      int
+	UnsubscribeUrl string
+}
+
+type Service struct {
+	settingsService settings.SettingsService
+	storageService  storage.StorageService
+	emailService    email.EmailService
+	timeService     timeS.TimeService
+	template        *template.Template
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewService(st settings.SettingsService, s storage.StorageService,
+	e email.EmailService, t timeS.TimeService) (*Service, error) {
+	digestTemplate, err := template.ParseFS(templateFS, "templates/digest.html")
+	if err != nil {
+		return nil, fmt.Errorf("could not parse digest template due to %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Service{
+		settingsService: st,
+		storageService:  s,
+		emailService:    e,
+		timeService:     t,
+		template:        digestTemplate,
+		ctx:             ctx,
+		cancel:          cancel,
+		done:            make(chan struct{}),
+	}, nil
+}
+
+func (s Service) Start() {
+	checkInterval := time.Duration(s.settingsService.Current().DigestConfig.CheckIntervalMinutes) * time.Minute
+	if checkInterval <= 0 {
+		checkInterval = defaultCheckInterval
+	}
+
+	go func() {
+		defer close(s.done)
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-s.timeService.After(s.ctx, checkInterval):
+				s.RunOnce(s.ctx, s.timeService.Now(s.ctx))
+			}
+		}
+	}()
+}
+
+// Blocks until any in progress digest has been sent, digests not yet
+// started are left for the next run
+func (s Service) Stop() {
+	s.cancel()
+	<-s.done
+}
+
+// Sends every digest that is due as of now, periods that have already been
+// claimed are skipped so it is safe to run repeatedly. Stops between digests
+// once ctx is done
+func (s Service) RunOnce(ctx context.Context, now time.Time) {
+	defaultFrequency := models.DigestFrequency(s.settingsService.Current().DigestConfig.DefaultFrequency)
+	if len(defaultFrequency) == 0 {
+		defaultFrequency = models.DigestFrequencyNone
+	}
+
+	for _, frequency := range []models.DigestFrequency{models.DigestFrequencyDaily, models.DigestFrequencyWeekly} {
+		periodStart, periodEnd := digestPeriod(frequency, now)
+
+		var afterUserId int64
+		for {
+			users, err := s.storageService.GetUsersForDigest(ctx, frequency, defaultFrequency, afterUserId, userBatchSize)
+			if err != nil {
+				logging.FromContext(ctx).Error("unable to fetch users for digest", "frequency", frequency, "error", err)
+				break
+			}
+
+			for _, user := range users {
+				if ctx.Err() != nil {
+					return
+				}
+
+				// A digest that has been claimed runs to completion so the
+				// claim is never left behind
+				err = s.sendDigest(context.WithoutCancel(ctx), user, frequency, periodStart, periodEnd)
+				if err != nil {
+					logging.FromContext(ctx).Error("unable to send digest", "frequency", frequency, "user_id", user.Id, "error", err)
+				}
+			}
+
+			if len(users) < userBatchSize {
+				break
+			}
+			afterUserId = users[len(users)-1].Id
+		}
+	}
+}
+
+func (s Service) sendDigest(ctx context.Context, user models.User, frequency models.DigestFrequency,
+	periodStart, periodEnd time.Time) error {
+	digest, err := s.storageService.ClaimEmailDigest(ctx, user.Id, frequency, periodStart, periodEnd,
+		s.timeService.Now(ctx).Add(-pendingClaimTimeout))
+	if err != nil {
+		switch err.(type) {
+		case storage.EmailDigestAlreadyClaimedError:
+			return nil
+		}
+
+		return err
+	}
+
+	// The user may have been moderated or deleted since the batch was read
+	current, err := s.storageService.GetUserById(ctx, user.Id)
+	if err != nil {
+		switch err.(type) {
+		case storage.RecordNotFoundError:
+			return s.storageService.CompleteEmailDigest(ctx, digest.Id, models.EmailDigestStatusSkipped, 0)
+		}
+
+		s.releaseClaim(ctx, *digest)
+		return err
+	}
+	if isModerated(*current, s.timeService.Now(ctx)) {
+		return s.storageService.CompleteEmailDigest(ctx, digest.Id, models.EmailDigestStatusSkipped, 0)
+	}
+
+	digestConfig := s.settingsService.Current().DigestConfig
+	maximumNotificationCount := digestConfig.MaximumNotificationCount
+	if maximumNotificationCount <= 0 {
+		maximumNotificationCount = defaultMaximumNotificationCount
+	}
+
+	// Fetch one extra to know whether there is more than we will show
+	notifications, err := s.storageService.GetUnreadNotificationsBetween(ctx, user.Id,
+		periodStart, periodEnd, maximumNotificationCount+1)
+	if err != nil {
+		s.releaseClaim(ctx, *digest)
+		return err
+	}
+
+	if len(notifications) == 0 {
+		return s.storageService.CompleteEmailDigest(ctx, digest.Id, models.EmailDigestStatusSkipped, 0)
+	}
+
+	data := digestTemplateData{
+		Username:    user.Username,
+		Frequency:   frequency,
+		PeriodLabel: periodLabel(frequency),
+		UnsubscribeUrl: BuildUnsubscribeUrl(digestConfig.UnsubscribeBaseUrl,
+			digestConfig.UnsubscribeSigningKey, user.Id),
+	}
+	for idx, n := range notifications {
+		if idx == maximumNotificationCount {
+			data.MoreCount = len(notifications) - maximumNotificationCount
+			break
+		}
+		data.Summaries = append(data.Summaries, notification.Describe(n, n.LatestActor.Username))
+	}
+
+	var body bytes.Buffer
+	err = s.template.Execute(&body, data)
+	if err != nil {
+		s.releaseClaim(ctx, *digest)
+		return err
+	}
+
+	subject := fmt.Sprintf("Your %s Angry Pros digest", frequency)
+	headers := map[string]string{
+		"List-Unsubscribe":      fmt.Sprintf("<%s>", data.UnsubscribeUrl),
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+
+	err = s.emailService.SendHTML(ctx, user.NormalisedEmailAddress, subject, body.String(), headers)
+	if err != nil {
+		s.releaseClaim(ctx, *digest)
+		return err
+	}
+
+	return s.storageService.CompleteEmailDigest(ctx, digest.Id, models.EmailDigestStatusSent,
+		len(notifications))
+}
+
+// Mirrors the filter applied by GetUsersForDigest
+func isModerated(user models.User, now time.Time) bool {
+	return user.HiddenAt != nil || user.ShadowbannedAt != nil || user.IsSuspended(now)
+}
+
+func (s Service) releaseClaim(ctx context.Context, digest models.EmailDigest) {
+	err := s.storageService.DeleteEmailDigest(ctx, digest.Id)
+	if err != nil {
+		logging.FromContext(ctx).Error("unable to release email digest claim", "digest_id", digest.Id, "error", err)
+	}
+}
+
+// Digests always cover the most recent complete UTC day or ISO week
+func digestPeriod(frequency models.DigestFrequency, now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	if frequency == models.DigestFrequencyWeekly {
+		daysSinceMonday := (int(today.Weekday()) + 6) % 7
+		weekStart := today.AddDate(0, 0, -daysSinceMonday)
+		return weekStart.AddDate(0, 0, -7), weekStart
+	}
+
+	return today.AddDate(0, 0, -1), today
+}
+
+func periodLabel(frequency models.DigestFrequency) string {
+	if frequency == models.DigestFrequencyWeekly {
+		return "last week"
+	}
+
+	return "yesterday"
+}
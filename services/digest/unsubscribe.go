@@ -0,0 +1,41 @@
+package digest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const (
+	unsubscribeSignaturePurpose = "digest-unsubscribe"
+)
+
+// Unsubscribe links carry an HMAC of the user id so they work without the
+// user being signed in while still being unforgeable
+func SignUnsubscribe(signingKey string, userId int64) string {
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	fmt.Fprintf(mac, "%s:%d", unsubscribeSignaturePurpose, userId)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func VerifyUnsubscribe(signingKey string, userId int64, signature string) bool {
+	if len(signingKey) == 0 {
+		return false
+	}
+
+	expectedSignature := SignUnsubscribe(signingKey, userId)
+
+	return hmac.Equal([]byte(expectedSignature), []byte(signature))
+}
+
+func BuildUnsubscribeUrl(baseUrl, signingKey string, userId int64) string {
+	query := url.Values{}
+	query.Set("userId", strconv.FormatInt(userId, 10))
+	query.Set("signature", SignUnsubscribe(signingKey, userId))
+
+	return fmt.Sprintf("%s?%s", baseUrl, query.Encode())
+}
@@ -0,0 +1,151 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"sort"
+	"strings"
+
+	"github.com/rawfish-dev/angrypros-api/config"
+	"github.com/rawfish-dev/angrypros-api/services/logging"
+)
+
+var _ EmailService = new(Service)
+
+var (
+	headerValueSanitiser = strings.NewReplacer("\r", "", "\n", "")
+)
+
+type EmailService interface {
+	SendHTML(ctx context.Context, toAddress, subject, htmlBody string, extraHeaders map[string]string) error
+}
+
+type Service struct {
+	address     string
+	auth        smtp.Auth
+	fromAddress string
+}
+
+func NewService(e config.EmailConfig) *Service {
+	var auth smtp.Auth
+	if len(e.SMTPUsername) != 0 {
+		auth = smtp.PlainAuth("", e.SMTPUsername, e.SMTPPassword, e.SMTPHost)
+	}
+
+	return &Service{
+		address:     fmt.Sprintf("%s:%s", e.SMTPHost, e.SMTPPort),
+		auth:        auth,
+		fromAddress: e.FromAddress,
+	}
+}
+
+func (s Service) SendHTML(ctx context.Context, toAddress, subject, htmlBody string, extraHeaders map[string]string) error {
+	headers := map[string]string{
+		"From":         s.fromAddress,
+		"To":           toAddress,
+		"Subject":      mime.QEncoding.Encode("utf-8", subject),
+		"MIME-Version": "1.0",
+		"Content-Type": `text/html; charset="utf-8"`,
+	}
+	for key, value := range extraHeaders {
+		headers[key] = value
+	}
+
+	// Sorted for a stable message layout
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var message bytes.Buffer
+	for _, key := range keys {
+		fmt.Fprintf(&message, "%s: %s\r\n", key, headerValueSanitiser.Replace(headers[key]))
+	}
+	message.WriteString("\r\n")
+	message.WriteString(htmlBody)
+
+	err := s.sendMail(ctx, toAddress, message.Bytes())
+	if err != nil {
+		logging.FromContext(ctx).Error("unable to send email via smtp", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// Follows smtp.SendMail but dials with ctx and abandons the connection once
+// ctx is done, as smtp.SendMail offers no way to bound how long it takes
+func (s Service) sendMail(ctx context.Context, toAddress string, message []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return err
+	}
+
+	stopClosing := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stopClosing()
+
+	host, _, err := net.SplitHostPort(s.address)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: host})
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.auth != nil {
+		if ok, _ := client.Extension("AUTH"); ok {
+			err = client.Auth(s.auth)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = client.Mail(s.fromAddress)
+	if err != nil {
+		return err
+	}
+
+	err = client.Rcpt(toAddress)
+	if err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(message)
+	if err != nil {
+		return err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
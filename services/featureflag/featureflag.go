@@ -0,0 +1,96 @@
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/rawfish-dev/angrypros-api/config"
+	"github.com/rawfish-dev/angrypros-api/models"
+	"github.com/rawfish-dev/angrypros-api/services/settings"
+)
+
+// Flags are read from the runtime settings so rollouts can be widened or
+// switched off without a restart. Flags that are not configured are off
+
+var _ FeatureFlagService = new(Service)
+
+type FeatureFlagService interface {
+	// User is nil for anonymous requests, which only see fully rolled out flags
+	IsEnabled(ctx context.Context, flag string, user *models.User) bool
+	// Every configured flag keyed by name, for clients to hide unreleased UI
+	Evaluate(ctx context.Context, user *models.User) map[string]bool
+}
+
+type Service struct {
+	settingsService settings.SettingsService
+}
+
+func NewService(st settings.SettingsService) *Service {
+	return &Service{
+		settingsService: st,
+	}
+}
+
+func (s Service) IsEnabled(ctx context.Context, flag string, user *models.User) bool {
+	flagConfig, exists := s.settingsService.Current().FeatureFlagsConfig[flag]
+	if !exists {
+		return false
+	}
+
+	return enabledFor(flag, flagConfig, user)
+}
+
+func (s Service) Evaluate(ctx context.Context, user *models.User) map[string]bool {
+	flags := s.settingsService.Current().FeatureFlagsConfig
+
+	evaluated := make(map[string]bool, len(flags))
+	for flag, flagConfig := range flags {
+		evaluated[flag] = enabledFor(flag, flagConfig, user)
+	}
+
+	return evaluated
+}
+
+func enabledFor(flag string, flagConfig config.FeatureFlagConfig, user *models.User) bool {
+	if !flagConfig.Enabled {
+		return false
+	}
+	if flagConfig.Percentage >= 100 {
+		return true
+	}
+	if user == nil {
+		return false
+	}
+
+	for _, userId := range flagConfig.UserIds {
+		if userId == user.Id {
+			return true
+		}
+	}
+
+	for _, role := range flagConfig.Roles {
+		for _, userRole := range user.Roles {
+			if string(userRole.Role) == role {
+				return true
+			}
+		}
+	}
+
+	for _, country := range flagConfig.Countries {
+		if country == user.CountryIsoAlpha2Code {
+			return true
+		}
+	}
+
+	return bucket(flag, user.Id) < flagConfig.Percentage
+}
+
+// Buckets are salted with the flag name so each flag rolls out to a
+// different slice of users
+func bucket(flag string, userId int64) int {
+	hash := fnv.New32a()
+	fmt.Fprintf(hash, "%s:%d", flag, userId)
+
+	return int(hash.Sum32() % 100)
+}
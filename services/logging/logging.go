@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/rawfish-dev/angrypros-api/config"
+)
+
+// Builds the structured logger used across the API and carries request
+// scoped loggers, annotated with ids such as the request and user, through
+// a context
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+type contextKey struct{}
+
+func New(lc config.LoggingConfig, w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if len(lc.Level) != 0 {
+		err := level.UnmarshalText([]byte(lc.Level))
+		if err != nil {
+			return nil, fmt.Errorf("log level '%s' is unknown", lc.Level)
+		}
+	}
+
+	opts := &slog.HandlerOptions{
+		Level: level,
+	}
+
+	switch strings.ToLower(lc.Format) {
+	case "", FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	}
+
+	return nil, fmt.Errorf("log format '%s' is unknown", lc.Format)
+}
+
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// Falls back to the default logger when the context carries none
+func FromContext(ctx context.Context) *slog.Logger {
+	logger, ok := ctx.Value(contextKey{}).(*slog.Logger)
+	if !ok {
+		return slog.Default()
+	}
+
+	return logger
+}
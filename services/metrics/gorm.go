@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	gormPluginName      = "metrics"
+	gormStartTimeKey    = "metrics:start_time"
+	gormUnknownTable    = "unknown"
+	gormCallbackPrefix  = "metrics:"
+	gormCallbackBefore  = gormCallbackPrefix + "before_"
+	gormCallbackAfter   = gormCallbackPrefix + "after_"
+	gormOperationCreate = "create"
+	gormOperationQuery  = "query"
+	gormOperationUpdate = "update"
+	gormOperationDelete = "delete"
+	gormOperationRow    = "row"
+	gormOperationRaw    = "raw"
+)
+
+var _ gorm.Plugin = new(GormPlugin)
+
+// Times every GORM operation by hooking in before and after the callbacks
+// that execute the statement
+type GormPlugin struct {
+	metrics *Metrics
+}
+
+func NewGormPlugin(m *Metrics) *GormPlugin {
+	return &GormPlugin{
+		metrics: m,
+	}
+}
+
+func (p GormPlugin) Name() string {
+	return gormPluginName
+}
+
+func (p GormPlugin) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+
+	registrations := []struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}{
+		{gormOperationCreate, callback.Create().Before("gorm:create").Register, callback.Create().After("gorm:create").Register},
+		{gormOperationQuery, callback.Query().Before("gorm:query").Register, callback.Query().After("gorm:query").Register},
+		{gormOperationUpdate, callback.Update().Before("gorm:update").Register, callback.Update().After("gorm:update").Register},
+		{gormOperationDelete, callback.Delete().Before("gorm:delete").Register, callback.Delete().After("gorm:delete").Register},
+		{gormOperationRow, callback.Row().Before("gorm:row").Register, callback.Row().After("gorm:row").Register},
+		{gormOperationRaw, callback.Raw().Before("gorm:raw").Register, callback.Raw().After("gorm:raw").Register},
+	}
+
+	for _, registration := range registrations {
+		err := registration.before(gormCallbackBefore+registration.operation, p.before)
+		if err != nil {
+			return err
+		}
+
+		err = registration.after(gormCallbackAfter+registration.operation, p.after(registration.operation))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p GormPlugin) before(db *gorm.DB) {
+	db.InstanceSet(gormStartTimeKey, time.Now())
+}
+
+func (p GormPlugin) after(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		value, exists := db.InstanceGet(gormStartTimeKey)
+		if !exists {
+			return
+		}
+
+		table := db.Statement.Table
+		if len(table) == 0 {
+			table = gormUnknownTable
+		}
+
+		failed := db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound)
+
+		p.metrics.ObserveDBQuery(operation, table, time.Since(value.(time.Time)).Seconds(), failed)
+	}
+}
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus collectors for the API, registered on a dedicated registry so
+// they are only exposed through the internal metrics listener
+
+const (
+	namespace = "angrypros"
+
+	// Used in place of a route template when no route matched
+	RouteUnmatched = "unmatched"
+
+	TokenVerificationValid   = "valid"
+	TokenVerificationExpired = "expired"
+	TokenVerificationInvalid = "invalid"
+	// Verification could not be attempted, such as when certificates
+	// could not be fetched
+	TokenVerificationError = "error"
+)
+
+// Observe methods may be called on a nil *Metrics in which case nothing is
+// recorded
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests        *prometheus.CounterVec
+	httpRequestDuration *prometheus.HistogramVec
+	dbQueryDuration     *prometheus.HistogramVec
+	dbQueryErrors       *prometheus.CounterVec
+	tokenVerifications  *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "HTTP requests handled by route template, method and status.",
+		}, []string{"route", "method", "status"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency by route template, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		dbQueryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "db",
+			Name:      "query_duration_seconds",
+			Help:      "Database query latency by operation and table.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "table"}),
+		dbQueryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "db",
+			Name:      "query_errors_total",
+			Help:      "Database queries which failed by operation and table, not found is not counted.",
+		}, []string{"operation", "table"}),
+		tokenVerifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "auth",
+			Name:      "token_verifications_total",
+			Help:      "Id token verifications by outcome.",
+		}, []string{"outcome"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpRequestDuration,
+		m.dbQueryDuration,
+		m.dbQueryErrors,
+		m.tokenVerifications,
+	)
+
+	return m
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Exposes connection pool statistics such as open, idle and in use
+// connections along with wait counts
+func (m *Metrics) RegisterDBStats(db *sql.DB, dbName string) error {
+	return m.registry.Register(collectors.NewDBStatsCollector(db, dbName))
+}
+
+func (m *Metrics) ObserveHTTPRequest(route, method, status string, seconds float64) {
+	if m == nil {
+		return
+	}
+
+	m.httpRequests.WithLabelValues(route, method, status).Inc()
+	m.httpRequestDuration.WithLabelValues(route, method, status).Observe(seconds)
+}
+
+func (m *Metrics) ObserveDBQuery(operation, table string, seconds float64, failed bool) {
+	if m == nil {
+		return
+	}
+
+	m.dbQueryDuration.WithLabelValues(operation, table).Observe(seconds)
+	if failed {
+		m.dbQueryErrors.WithLabelValues(operation, table).Inc()
+	}
+}
+
+func (m *Metrics) ObserveTokenVerification(outcome string) {
+	if m == nil {
+		return
+	}
+
+	m.tokenVerifications.WithLabelValues(outcome).Inc()
+}
@@ -0,0 +1,153 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+	"github.com/rawfish-dev/angrypros-api/services/logging"
+	"github.com/rawfish-dev/angrypros-api/services/push"
+	"github.com/rawfish-dev/angrypros-api/services/storage"
+)
+
+// Entry point for emitting notifications so that the features producing
+// events do not need to know how notifications are stored or delivered
+
+const (
+	pushMessageTitle = "Angry Pros"
+)
+
+var _ NotificationService = new(Service)
+
+var (
+	notificationActions = map[models.NotificationType]string{
+		models.NotificationTypeComment:  "commented on your entry",
+		models.NotificationTypeReply:    "replied to your comment",
+		models.NotificationTypeReaction: "raged at your entry",
+		models.NotificationTypeMention:  "mentioned you",
+		models.NotificationTypeFollow:   "followed you",
+	}
+)
+
+type NotificationService interface {
+	Notify(ctx context.Context, recipientUserId, actorUserId int64, notificationType models.NotificationType,
+		targetType models.NotificationTargetType, targetId int64) error
+}
+
+type Service struct {
+	storageService storage.StorageService
+	pushDispatcher push.PushDispatcher
+
+	// Push deliveries still in flight
+	deliveries *sync.WaitGroup
+}
+
+func NewService(s storage.StorageService, p push.PushDispatcher) *Service {
+	return &Service{
+		storageService: s,
+		pushDispatcher: p,
+		deliveries:     new(sync.WaitGroup),
+	}
+}
+
+// Blocks until in flight push deliveries finish, call once requests have
+// drained and before storage is closed
+func (s Service) Stop() {
+	s.deliveries.Wait()
+}
+
+func (s Service) Notify(ctx context.Context, recipientUserId, actorUserId int64, notificationType models.NotificationType,
+	targetType models.NotificationTargetType, targetId int64) error {
+	// Users are never notified about their own actions
+	if recipientUserId == actorUserId {
+		return nil
+	}
+
+	notification, err := s.storageService.CreateOrAggregateNotification(ctx, recipientUserId, actorUserId,
+		notificationType, targetType, targetId)
+	if err != nil {
+		return err
+	}
+
+	// Push delivery is best effort and should not hold up the action that
+	// triggered the notification, nor be cancelled when that action's
+	// request completes
+	s.deliveries.Add(1)
+	go func() {
+		defer s.deliveries.Done()
+		s.deliverPush(context.WithoutCancel(ctx), *notification)
+	}()
+
+	return nil
+}
+
+func (s Service) deliverPush(ctx context.Context, notification models.Notification) {
+	preferences, err := s.storageService.GetNotificationPreferences(ctx, notification.RecipientUserId)
+	if err != nil {
+		logging.FromContext(ctx).Error("unable to fetch notification preferences", "user_id", notification.RecipientUserId, "error", err)
+		return
+	}
+	for _, preference := range preferences {
+		if preference.NotificationType == notification.Type && !preference.PushEnabled {
+			return
+		}
+	}
+
+	deviceTokens, err := s.storageService.GetDeviceTokensByUserId(ctx, notification.RecipientUserId)
+	if err != nil {
+		logging.FromContext(ctx).Error("unable to fetch device tokens", "user_id", notification.RecipientUserId, "error", err)
+		return
+	}
+	if len(deviceTokens) == 0 {
+		return
+	}
+
+	actor, err := s.storageService.GetUserById(ctx, notification.LatestActorUserId)
+	if err != nil {
+		logging.FromContext(ctx).Error("unable to fetch notification actor", "user_id", notification.LatestActorUserId, "error", err)
+		return
+	}
+
+	tokens := make([]string, len(deviceTokens))
+	for idx := range deviceTokens {
+		tokens[idx] = deviceTokens[idx].Token
+	}
+
+	invalidTokens, err := s.pushDispatcher.Send(ctx, tokens, buildPushMessage(notification, *actor))
+	if err != nil {
+		logging.FromContext(ctx).Error("unable to dispatch push notification", "notification_id", notification.Id, "error", err)
+	}
+
+	err = s.storageService.DeleteDeviceTokens(ctx, invalidTokens)
+	if err != nil {
+		logging.FromContext(ctx).Error("unable to remove invalid device tokens", "error", err)
+	}
+}
+
+// Human readable summary of a notification such as "alice and 2 others
+// raged at your entry"
+func Describe(notification models.Notification, actorUsername string) string {
+	actors := actorUsername
+	if notification.ActorCount == 2 {
+		actors = fmt.Sprintf("%s and 1 other", actorUsername)
+	} else if notification.ActorCount > 2 {
+		actors = fmt.Sprintf("%s and %d others", actorUsername, notification.ActorCount-1)
+	}
+
+	return fmt.Sprintf("%s %s", actors, notificationActions[notification.Type])
+}
+
+func buildPushMessage(notification models.Notification, actor models.User) push.Message {
+	return push.Message{
+		Title: pushMessageTitle,
+		Body:  Describe(notification, actor.Username),
+		Data: map[string]string{
+			"notificationId": strconv.FormatInt(notification.Id, 10),
+			"type":           string(notification.Type),
+			"targetType":     string(notification.TargetType),
+			"targetId":       strconv.FormatInt(notification.TargetId, 10),
+		},
+	}
+}
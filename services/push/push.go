@@ -0,0 +1,115 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	firebase "firebase.google.com/go/v4"
+	"firebase.google.com/go/v4/messaging"
+	"google.golang.org/api/option"
+
+	"github.com/rawfish-dev/angrypros-api/config"
+	"github.com/rawfish-dev/angrypros-api/services/logging"
+)
+
+const (
+	// Limit imposed by FCM on a single multicast request
+	fcmMulticastTokenLimit = 500
+	// Named by FCM in invalid argument errors caused by a malformed token
+	fcmRegistrationTokenErrorText = "registration token"
+)
+
+var _ PushDispatcher = new(FCMDispatcher)
+
+type PushDispatcher interface {
+	// Returns the subset of device tokens the provider reported as no longer
+	// valid so that callers can stop sending to them
+	Send(ctx context.Context, deviceTokens []string, message Message) (invalidDeviceTokens []string, err error)
+}
+
+type Message struct {
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+type FCMDispatcher struct {
+	firebaseApp *firebase.App
+}
+
+func NewFCMDispatcher(g config.GoogleConfig) (*FCMDispatcher, error) {
+	googleConfigBytes, err := json.Marshal(g)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal google config to bytes due to %s", err)
+	}
+
+	opt := option.WithCredentialsJSON(googleConfigBytes)
+	firebaseApp, err := firebase.NewApp(context.Background(), nil, opt)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing firebase app due to %s", err)
+	}
+
+	return &FCMDispatcher{
+		firebaseApp: firebaseApp,
+	}, nil
+}
+
+func (f FCMDispatcher) Send(ctx context.Context, deviceTokens []string, message Message) ([]string, error) {
+	messagingClient, err := f.firebaseApp.Messaging(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("encountered error while creating Firebase messaging client", "error", err)
+		return nil, err
+	}
+
+	var invalidDeviceTokens []string
+
+	for start := 0; start < len(deviceTokens); start += fcmMulticastTokenLimit {
+		end := start + fcmMulticastTokenLimit
+		if end > len(deviceTokens) {
+			end = len(deviceTokens)
+		}
+		batchTokens := deviceTokens[start:end]
+
+		batchResponse, err := messagingClient.SendMulticast(ctx, &messaging.MulticastMessage{
+			Tokens: batchTokens,
+			Data:   message.Data,
+			Notification: &messaging.Notification{
+				Title: message.Title,
+				Body:  message.Body,
+			},
+		})
+		if err != nil {
+			logging.FromContext(ctx).Error("unable to send multicast message with Firebase", "error", err)
+			return invalidDeviceTokens, err
+		}
+
+		for idx, sendResponse := range batchResponse.Responses {
+			if sendResponse.Success {
+				continue
+			}
+
+			if isDeadDeviceToken(sendResponse.Error) {
+				invalidDeviceTokens = append(invalidDeviceTokens, batchTokens[idx])
+				continue
+			}
+
+			logging.FromContext(ctx).Warn("unable to deliver push message with Firebase", "error", sendResponse.Error)
+		}
+	}
+
+	return invalidDeviceTokens, nil
+}
+
+// Invalid argument is also returned for problems with the message itself,
+// such as an oversized payload, so it only marks the token as dead when the
+// error is about the registration token
+func isDeadDeviceToken(err error) bool {
+	if messaging.IsRegistrationTokenNotRegistered(err) {
+		return true
+	}
+
+	return messaging.IsInvalidArgument(err) &&
+		strings.Contains(strings.ToLower(err.Error()), fcmRegistrationTokenErrorText)
+}
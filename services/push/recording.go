@@ -0,0 +1,59 @@
+package push
+
+import (
+	"context"
+	"sync"
+)
+
+// A dispatcher that records messages instead of delivering them, meant for
+// tests and local development
+
+var _ PushDispatcher = new(RecordingDispatcher)
+
+type SentMessage struct {
+	DeviceTokens []string
+	Message      Message
+}
+
+type RecordingDispatcher struct {
+	mu                  sync.Mutex
+	sentMessages        []SentMessage
+	invalidDeviceTokens map[string]bool
+}
+
+func NewRecordingDispatcher(invalidDeviceTokens ...string) *RecordingDispatcher {
+	r := &RecordingDispatcher{
+		invalidDeviceTokens: make(map[string]bool),
+	}
+	for _, invalidDeviceToken := range invalidDeviceTokens {
+		r.invalidDeviceTokens[invalidDeviceToken] = true
+	}
+
+	return r
+}
+
+func (r *RecordingDispatcher) Send(ctx context.Context, deviceTokens []string, message Message) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sentMessages = append(r.sentMessages, SentMessage{
+		DeviceTokens: append([]string(nil), deviceTokens...),
+		Message:      message,
+	})
+
+	var invalidDeviceTokens []string
+	for _, deviceToken := range deviceTokens {
+		if r.invalidDeviceTokens[deviceToken] {
+			invalidDeviceTokens = append(invalidDeviceTokens, deviceToken)
+		}
+	}
+
+	return invalidDeviceTokens, nil
+}
+
+func (r *RecordingDispatcher) SentMessages() []SentMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]SentMessage(nil), r.sentMessages...)
+}
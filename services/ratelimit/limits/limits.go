@@ -0,0 +1,31 @@
+package limits
+
+// Names of the limits as they appear in the rateLimit section of the config.
+// Kept apart from the ratelimit package, which depends on settings, so that
+// config validation can import them without a cycle
+
+const (
+	// Route groups share one bucket per caller
+	Public     = "public"
+	Authed     = "authed"
+	Moderation = "moderation"
+	Admin      = "admin"
+
+	// Actions get their own bucket
+	Register = "register"
+	Report   = "report"
+
+	// Appended to a limit name for the additional limit applied to new accounts
+	NewAccountSuffix = "-new-account"
+)
+
+var (
+	Known = []string{
+		Public,
+		Authed,
+		Moderation,
+		Admin,
+		Register,
+		Report,
+	}
+)
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// Buckets untouched for this long are dropped, by then they have refilled
+	// under any sensible limit
+	memoryStoreBucketTTL = time.Hour
+	// Least recently used buckets are dropped beyond this many to bound
+	// memory use when many distinct callers are seen within the TTL
+	memoryStoreMaxBuckets = 100000
+)
+
+var _ Store = new(MemoryStore)
+
+type memoryBucket struct {
+	key       string
+	tokens    float64
+	updatedAt time.Time
+}
+
+// Keeps buckets in process, only suitable for a single instance deployment.
+// Buckets are kept in least recently used order so eviction only ever looks
+// at the oldest, keeping each call constant time
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	order   *list.List
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (m *MemoryStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.evict(now)
+
+	var bucket *memoryBucket
+	element, exists := m.buckets[key]
+	if exists {
+		bucket = element.Value.(*memoryBucket)
+		m.order.MoveToFront(element)
+	} else {
+		bucket = &memoryBucket{
+			key:       key,
+			tokens:    limit.Capacity,
+			updatedAt: now,
+		}
+		m.buckets[key] = m.order.PushFront(bucket)
+	}
+
+	bucket.tokens = refill(bucket.tokens, bucket.updatedAt, limit, now)
+	bucket.updatedAt = now
+
+	if bucket.tokens < 1 {
+		return false, retryAfter(bucket.tokens, limit), nil
+	}
+
+	bucket.tokens--
+
+	return true, 0, nil
+}
+
+// Drops idle buckets from the back of the list, then the least recently used
+// until there is room for one more
+func (m *MemoryStore) evict(now time.Time) {
+	for oldest := m.order.Back(); oldest != nil; oldest = m.order.Back() {
+		bucket := oldest.Value.(*memoryBucket)
+		if now.Sub(bucket.updatedAt) < memoryStoreBucketTTL && m.order.Len() < memoryStoreMaxBuckets {
+			return
+		}
+
+		m.order.Remove(oldest)
+		delete(m.buckets, bucket.key)
+	}
+}
+
+func refill(tokens float64, updatedAt time.Time, limit Limit, now time.Time) float64 {
+	elapsed := now.Sub(updatedAt).Seconds()
+	if elapsed <= 0 {
+		return tokens
+	}
+
+	return math.Min(limit.Capacity, tokens+elapsed*limit.RefillPerSecond)
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/rawfish-dev/angrypros-api/services/logging"
+	"github.com/rawfish-dev/angrypros-api/services/storage"
+)
+
+const (
+	// Buckets untouched for this long have refilled under any sensible
+	// limit, so dropping them behaves the same as keeping them
+	postgresStoreBucketTTL = 24 * time.Hour
+	// How often stale buckets are pruned, at most once per interval across
+	// the requests handled by this instance
+	postgresStorePruneInterval = 10 * time.Minute
+)
+
+var _ Store = new(PostgresStore)
+
+// Keeps buckets in Postgres so limits hold across multiple instances
+type PostgresStore struct {
+	storageService storage.RateLimitStorage
+
+	// Unix nanoseconds of the last prune
+	lastPruned *int64
+}
+
+func NewPostgresStore(s storage.RateLimitStorage) *PostgresStore {
+	return &PostgresStore{
+		storageService: s,
+		lastPruned:     new(int64),
+	}
+}
+
+func (p PostgresStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	p.pruneIfDue(ctx, now)
+
+	bucket, err := p.storageService.TakeRateLimitToken(ctx, key, limit.Capacity, limit.RefillPerSecond, now)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if !bucket.Allowed {
+		return false, retryAfter(bucket.Tokens, limit), nil
+	}
+
+	return true, 0, nil
+}
+
+// Only the caller that wins the swap prunes so concurrent requests do not
+// all issue the delete
+func (p PostgresStore) pruneIfDue(ctx context.Context, now time.Time) {
+	lastPruned := atomic.LoadInt64(p.lastPruned)
+	if now.Sub(time.Unix(0, lastPruned)) < postgresStorePruneInterval {
+		return
+	}
+	if !atomic.CompareAndSwapInt64(p.lastPruned, lastPruned, now.UnixNano()) {
+		return
+	}
+
+	pruned, err := p.storageService.DeleteRateLimitBucketsBefore(ctx, now.Add(-postgresStoreBucketTTL))
+	if err != nil {
+		logging.FromContext(ctx).Error("unable to prune rate limit buckets", "error", err)
+		return
+	}
+
+	logging.FromContext(ctx).Debug("pruned rate limit buckets", "count", pruned)
+}
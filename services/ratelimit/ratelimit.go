@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/rawfish-dev/angrypros-api/services/logging"
+	"github.com/rawfish-dev/angrypros-api/services/settings"
+	timeS "github.com/rawfish-dev/angrypros-api/services/time"
+)
+
+// Token bucket rate limiting where each named limit has its own capacity
+// and refill rate, and bucket state is kept in a pluggable store
+
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+)
+
+var _ RateLimiter = new(Service)
+
+type RateLimiter interface {
+	// Limits that are not configured always allow
+	Allow(ctx context.Context, limitName, subject string) (allowed bool, retryAfter time.Duration)
+}
+
+type Limit struct {
+	Capacity        float64
+	RefillPerSecond float64
+}
+
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (allowed bool, retryAfter time.Duration, err error)
+}
+
+type Service struct {
+	settingsService settings.SettingsService
+	store           Store
+	timeService     timeS.TimeService
+}
+
+// Limits are read from the current settings on each call so changes apply
+// without a restart
+func NewService(st settings.SettingsService, store Store, t timeS.TimeService) *Service {
+	return &Service{
+		settingsService: st,
+		store:           store,
+		timeService:     t,
+	}
+}
+
+func (s Service) Allow(ctx context.Context, limitName, subject string) (bool, time.Duration) {
+	limitConfig, exists := s.settingsService.Current().RateLimitConfig.Limits[limitName]
+	if !exists {
+		return true, 0
+	}
+
+	limit := Limit{
+		Capacity:        float64(limitConfig.Burst),
+		RefillPerSecond: limitConfig.RequestsPerMinute / 60,
+	}
+
+	key := fmt.Sprintf("%s:%s", limitName, subject)
+
+	allowed, retryAfter, err := s.store.Take(ctx, key, limit, s.timeService.Now(ctx))
+	if err != nil {
+		// Fail open as an unavailable store should not take the API down
+		logging.FromContext(ctx).Error("unable to take rate limit token", "key", key, "error", err)
+		return true, 0
+	}
+
+	return allowed, retryAfter
+}
+
+// Time until the bucket holds a whole token again
+func retryAfter(tokens float64, limit Limit) time.Duration {
+	if tokens >= 1 || limit.RefillPerSecond <= 0 {
+		return 0
+	}
+
+	seconds := (1 - tokens) / limit.RefillPerSecond
+
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
@@ -0,0 +1,160 @@
+package screening
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	RuleBlockedTerms  = "blocked-terms"
+	RuleEmailAddress  = "email-address"
+	RulePhoneNumber   = "phone-number"
+	RuleStreetAddress = "street-address"
+
+	phoneNumberMinimumDigits = 7
+	phoneNumberMaximumDigits = 15
+)
+
+var (
+	emailAddressPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	phoneNumberPattern  = regexp.MustCompile(`\+?\(?\d[\d\s().\-]{5,}\d`)
+	// House number followed by up to four words and a street type
+	streetAddressPattern = regexp.MustCompile(`(?i)\b\d{1,5}\s+(?:[a-z0-9.'\-]+\s+){0,4}` +
+		`(?:street|st|avenue|ave|road|rd|boulevard|blvd|lane|ln|drive|dr|court|ct|way|place|pl|terrace|crescent|close)\b`)
+
+	// Substitutions are ASCII to ASCII so normalised text keeps the same
+	// byte offsets as the original, which masking relies on
+	leetspeakDigitReplacer = strings.NewReplacer(
+		"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t",
+	)
+	leetspeakSymbolReplacer = strings.NewReplacer(
+		"@", "a", "$", "s", "!", "i", "|", "l", "+", "t",
+	)
+)
+
+type Rule interface {
+	Name() string
+	// Completes the sentence "<field> ..." when explaining a rejection
+	Description() string
+	// Returns byte offset pairs of every match in text
+	FindAll(text string) [][]int
+}
+
+type blockedTermsRule struct {
+	pattern *regexp.Regexp
+}
+
+func newBlockedTermsRule(blockedTerms []string) *blockedTermsRule {
+	quotedTerms := make([]string, 0, len(blockedTerms))
+	for _, blockedTerm := range blockedTerms {
+		normalisedTerm := normaliseLeetspeak(strings.TrimSpace(blockedTerm), true)
+		if len(normalisedTerm) != 0 {
+			quotedTerms = append(quotedTerms, regexp.QuoteMeta(normalisedTerm))
+		}
+	}
+
+	if len(quotedTerms) == 0 {
+		return &blockedTermsRule{}
+	}
+
+	return &blockedTermsRule{
+		pattern: regexp.MustCompile(`\b(?:` + strings.Join(quotedTerms, "|") + `)\b`),
+	}
+}
+
+func (b blockedTermsRule) Name() string {
+	return RuleBlockedTerms
+}
+
+func (b blockedTermsRule) Description() string {
+	return "contains a blocked term"
+}
+
+func (b blockedTermsRule) FindAll(text string) [][]int {
+	if b.pattern == nil {
+		return nil
+	}
+
+	// Symbols are tried both ways as they double as punctuation, otherwise
+	// the "!" in "b4dw0rd!" would hide the word boundary
+	matches := b.pattern.FindAllStringIndex(normaliseLeetspeak(text, false), -1)
+	matches = append(matches, b.pattern.FindAllStringIndex(normaliseLeetspeak(text, true), -1)...)
+
+	return matches
+}
+
+type patternRule struct {
+	name        string
+	description string
+	pattern     *regexp.Regexp
+	accept      func(match string) bool
+}
+
+func (p patternRule) Name() string {
+	return p.name
+}
+
+func (p patternRule) Description() string {
+	return p.description
+}
+
+func (p patternRule) FindAll(text string) [][]int {
+	var matches [][]int
+
+	for _, match := range p.pattern.FindAllStringIndex(text, -1) {
+		if p.accept == nil || p.accept(text[match[0]:match[1]]) {
+			matches = append(matches, match)
+		}
+	}
+
+	return matches
+}
+
+func newEmailAddressRule() patternRule {
+	return patternRule{
+		name:        RuleEmailAddress,
+		description: "contains an email address",
+		pattern:     emailAddressPattern,
+	}
+}
+
+func newPhoneNumberRule() patternRule {
+	return patternRule{
+		name:        RulePhoneNumber,
+		description: "contains a phone number",
+		pattern:     phoneNumberPattern,
+		accept: func(match string) bool {
+			digitCount := 0
+			for _, r := range match {
+				if r >= '0' && r <= '9' {
+					digitCount++
+				}
+			}
+			return digitCount >= phoneNumberMinimumDigits && digitCount <= phoneNumberMaximumDigits
+		},
+	}
+}
+
+func newStreetAddressRule() patternRule {
+	return patternRule{
+		name:        RuleStreetAddress,
+		description: "contains a street address",
+		pattern:     streetAddressPattern,
+	}
+}
+
+func normaliseLeetspeak(text string, includeSymbols bool) string {
+	lowered := []byte(text)
+	for idx, b := range lowered {
+		if b >= 'A' && b <= 'Z' {
+			lowered[idx] = b + ('a' - 'A')
+		}
+	}
+
+	normalised := leetspeakDigitReplacer.Replace(string(lowered))
+	if includeSymbols {
+		normalised = leetspeakSymbolReplacer.Replace(normalised)
+	}
+
+	return normalised
+}
@@ -0,0 +1,160 @@
+package screening
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rawfish-dev/angrypros-api/config"
+)
+
+// Screens user submitted text against configured rules, each rule decides
+// whether a match rejects the text, masks it or lets it through while
+// flagging it for moderation
+
+type Action string
+
+const (
+	ActionReject   Action = "reject"
+	ActionMask     Action = "mask"
+	ActionModerate Action = "moderate"
+)
+
+var _ ScreeningService = new(Service)
+
+type ScreeningService interface {
+	Screen(ctx context.Context, text string) Result
+}
+
+type Violation struct {
+	Rule        string
+	Description string
+}
+
+type Result struct {
+	// Original text with any masked matches replaced by asterisks
+	Text       string
+	Rejections []Violation
+	Masks      []Violation
+	Flags      []Violation
+}
+
+type configuredRule struct {
+	rule   Rule
+	action Action
+}
+
+type Service struct {
+	rules []configuredRule
+}
+
+func NewService(sc config.ScreeningConfig) (*Service, error) {
+	availableRules := map[string]Rule{
+		RuleBlockedTerms:  newBlockedTermsRule(sc.BlockedTerms),
+		RuleEmailAddress:  newEmailAddressRule(),
+		RulePhoneNumber:   newPhoneNumberRule(),
+		RuleStreetAddress: newStreetAddressRule(),
+	}
+
+	s := &Service{}
+
+	for _, ruleConfig := range sc.Rules {
+		rule, exists := availableRules[ruleConfig.Rule]
+		if !exists {
+			return nil, fmt.Errorf("screening rule '%s' is unknown", ruleConfig.Rule)
+		}
+
+		action := Action(ruleConfig.Action)
+		switch action {
+		case ActionReject, ActionMask, ActionModerate:
+		default:
+			return nil, fmt.Errorf("screening action '%s' for rule '%s' is unknown",
+				ruleConfig.Action, ruleConfig.Rule)
+		}
+
+		s.rules = append(s.rules, configuredRule{
+			rule:   rule,
+			action: action,
+		})
+	}
+
+	return s, nil
+}
+
+func (s Service) Screen(ctx context.Context, text string) Result {
+	result := Result{
+		Text: text,
+	}
+
+	var maskSpans [][]int
+
+	for _, configuredRule := range s.rules {
+		matches := configuredRule.rule.FindAll(text)
+		if len(matches) == 0 {
+			continue
+		}
+
+		violation := Violation{
+			Rule:        configuredRule.rule.Name(),
+			Description: configuredRule.rule.Description(),
+		}
+
+		switch configuredRule.action {
+		case ActionReject:
+			result.Rejections = append(result.Rejections, violation)
+		case ActionMask:
+			result.Masks = append(result.Masks, violation)
+			maskSpans = append(maskSpans, matches...)
+		case ActionModerate:
+			result.Flags = append(result.Flags, violation)
+		}
+	}
+
+	if len(maskSpans) > 0 {
+		result.Text = mask(text, maskSpans)
+	}
+
+	return result
+}
+
+func (r Result) Rejected() bool {
+	return len(r.Rejections) > 0
+}
+
+func (r Result) Masked() bool {
+	return len(r.Masks) > 0
+}
+
+func (r Result) Flagged() bool {
+	return len(r.Flags) > 0
+}
+
+// Replaces each character within the spans with an asterisk, overlapping
+// spans are merged first
+func mask(text string, spans [][]int) string {
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i][0] < spans[j][0]
+	})
+
+	var masked strings.Builder
+	position := 0
+
+	for _, span := range spans {
+		start, end := span[0], span[1]
+		if end <= position {
+			continue
+		}
+		if start < position {
+			start = position
+		}
+
+		masked.WriteString(text[position:start])
+		masked.WriteString(strings.Repeat("*", utf8.RuneCountInString(text[start:end])))
+		position = end
+	}
+	masked.WriteString(text[position:])
+
+	return masked.String()
+}
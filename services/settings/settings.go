@@ -0,0 +1,173 @@
+package settings
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/rawfish-dev/angrypros-api/config"
+	timeS "github.com/rawfish-dev/angrypros-api/services/time"
+)
+
+// Runtime settings backed by the config file, which is polled for changes
+// and reloaded into a new validated snapshot. Sections holding connection
+// details or read once at startup keep their original values until restart
+
+var _ SettingsService = new(Service)
+
+type SettingsService interface {
+	// Snapshots are never modified so may be held for the whole request
+	Current() config.AppConfig
+}
+
+type Service struct {
+	environment     string
+	directoryPrefix string
+	configFilePath  string
+	reloadInterval  time.Duration
+	timeService     timeS.TimeService
+	snapshot        *atomic.Pointer[config.AppConfig]
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func NewService(initial config.AppConfig, env, directoryPrefix string, t timeS.TimeService) (*Service, error) {
+	configFilePath, err := config.FilePath(env, directoryPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := new(atomic.Pointer[config.AppConfig])
+	snapshot.Store(&initial)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Service{
+		environment:     env,
+		directoryPrefix: directoryPrefix,
+		configFilePath:  configFilePath,
+		reloadInterval:  time.Duration(initial.ServerConfig.SettingsReloadSeconds) * time.Second,
+		timeService:     t,
+		snapshot:        snapshot,
+		ctx:             ctx,
+		cancel:          cancel,
+		done:            make(chan struct{}),
+	}, nil
+}
+
+func (s Service) Current() config.AppConfig {
+	return *s.snapshot.Load()
+}
+
+// Polls the config file for changes, a zero reload interval leaves the
+// initial snapshot in place for the life of the process
+func (s Service) Start() {
+	if s.reloadInterval <= 0 {
+		close(s.done)
+		return
+	}
+
+	go func() {
+		defer close(s.done)
+
+		lastState := s.fileState()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-s.timeService.After(s.ctx, s.reloadInterval):
+				state := s.fileState()
+				if state == lastState {
+					continue
+				}
+				lastState = state
+
+				err := s.Reload()
+				if err != nil {
+					slog.Error("unable to reload settings, keeping previous values", "path", s.configFilePath,
+						"error", err)
+				}
+			}
+		}
+	}()
+}
+
+func (s Service) Stop() {
+	s.cancel()
+	<-s.done
+}
+
+// Replaces the snapshot only when the whole config loads and validates
+func (s Service) Reload() error {
+	next, err := config.NewAppConfig(s.environment, s.directoryPrefix)
+	if err != nil {
+		return err
+	}
+
+	ignored := keepRestartOnly(&next, s.Current())
+	if len(ignored) != 0 {
+		slog.Warn("settings changed that only apply after a restart", "settings", ignored)
+	}
+
+	s.snapshot.Store(&next)
+	slog.Info("reloaded settings", "path", s.configFilePath, "config", next.Redacted())
+
+	return nil
+}
+
+// Changes to files mounted from Kubernetes config maps show up as a new
+// modification time once the symlink is swapped
+func (s Service) fileState() fileState {
+	info, err := os.Stat(s.configFilePath)
+	if err != nil {
+		return fileState{}
+	}
+
+	return fileState{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}
+}
+
+// Copies restart-only settings from the running snapshot into next and
+// returns the names of any that differed
+func keepRestartOnly(next *config.AppConfig, running config.AppConfig) []string {
+	restartOnly := []struct {
+		name    string
+		next    interface{}
+		running interface{}
+	}{
+		{"server", &next.ServerConfig, running.ServerConfig},
+		{"logging", &next.LoggingConfig, running.LoggingConfig},
+		{"tracing", &next.TracingConfig, running.TracingConfig},
+		{"google", &next.GoogleConfig, running.GoogleConfig},
+		{"postgres", &next.PostgresConfig, running.PostgresConfig},
+		{"dospaces", &next.DigitalOceanSpacesConfig, running.DigitalOceanSpacesConfig},
+		{"email", &next.EmailConfig, running.EmailConfig},
+		{"screening", &next.ScreeningConfig, running.ScreeningConfig},
+		{"rateLimit.store", &next.RateLimitConfig.Store, running.RateLimitConfig.Store},
+		{"user.searchCacheSeconds", &next.UserConfig.SearchCacheSeconds, running.UserConfig.SearchCacheSeconds},
+		{"digest.checkIntervalMinutes", &next.DigestConfig.CheckIntervalMinutes, running.DigestConfig.CheckIntervalMinutes},
+	}
+
+	var ignored []string
+	for _, setting := range restartOnly {
+		nextValue := reflect.ValueOf(setting.next).Elem()
+		if !reflect.DeepEqual(nextValue.Interface(), setting.running) {
+			ignored = append(ignored, setting.name)
+		}
+		nextValue.Set(reflect.ValueOf(setting.running))
+	}
+
+	return ignored
+}
@@ -0,0 +1,146 @@
+package spam
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+	"github.com/rawfish-dev/angrypros-api/services/settings"
+	"github.com/rawfish-dev/angrypros-api/services/storage"
+	timeS "github.com/rawfish-dev/angrypros-api/services/time"
+)
+
+// Heuristics applied to submissions from recently created accounts, links
+// are refused outright while duplicate content and posting velocity only
+// flag the account for moderation so nothing is silently dropped
+
+var (
+	errLinksNotAllowed = errors.New("links cannot be posted by new accounts")
+
+	linkRegex = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+|\b[a-z0-9-]+\.(?:com|net|org|io|co|info|biz|xyz|ru|ly|me|link|click)\b`)
+)
+
+var _ SpamService = new(Service)
+
+type SpamService interface {
+	IsNewAccount(ctx context.Context, user models.User) bool
+	// Records the submission, so must only be called once per submission
+	Check(ctx context.Context, user models.User, text string) (*Result, error)
+}
+
+type Result struct {
+	Rejections []error
+	Flags      []string
+}
+
+func (r Result) Flagged() bool {
+	return len(r.Flags) > 0
+}
+
+type Service struct {
+	settingsService settings.SettingsService
+	storageService  storage.ContentFingerprintStorage
+	timeService     timeS.TimeService
+}
+
+func NewService(st settings.SettingsService, s storage.ContentFingerprintStorage, t timeS.TimeService) *Service {
+	return &Service{
+		settingsService: st,
+		storageService:  s,
+		timeService:     t,
+	}
+}
+
+func (s Service) IsNewAccount(ctx context.Context, user models.User) bool {
+	return s.accountAgeWithin(ctx, user, s.settingsService.Current().UserConfig.NewAccountDays)
+}
+
+func (s Service) Check(ctx context.Context, user models.User, text string) (*Result, error) {
+	now := s.timeService.Now(ctx)
+	userConfig := s.settingsService.Current().UserConfig
+	result := &Result{}
+
+	if s.accountAgeWithin(ctx, user, userConfig.NewAccountLinkDays) && linkRegex.MatchString(text) {
+		result.Rejections = append(result.Rejections, errLinksNotAllowed)
+		return result, nil
+	}
+
+	hash := fingerprint(text)
+
+	// Fingerprints are kept for every account so new accounts copying content
+	// posted by established ones are caught too
+	_, err := s.storageService.CreateContentFingerprint(ctx, user.Id, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.IsNewAccount(ctx, user) {
+		return result, nil
+	}
+
+	if len(hash) != 0 && userConfig.DuplicateContentWindowMinutes > 0 {
+		since := now.Add(-time.Duration(userConfig.DuplicateContentWindowMinutes) * time.Minute)
+
+		count, err := s.storageService.CountContentFingerprintsByHash(ctx, hash, since)
+		if err != nil {
+			return nil, err
+		}
+
+		if count > 1 {
+			result.Flags = append(result.Flags, fmt.Sprintf(
+				"posted content seen %d times in the last %d minutes",
+				count, userConfig.DuplicateContentWindowMinutes))
+		}
+	}
+
+	if userConfig.VelocityWindowMinutes > 0 && userConfig.VelocityMaxSubmissions > 0 {
+		since := now.Add(-time.Duration(userConfig.VelocityWindowMinutes) * time.Minute)
+
+		count, err := s.storageService.CountContentFingerprintsByUserId(ctx, user.Id, since)
+		if err != nil {
+			return nil, err
+		}
+
+		if count > int64(userConfig.VelocityMaxSubmissions) {
+			result.Flags = append(result.Flags, fmt.Sprintf(
+				"posted %d times in the last %d minutes",
+				count, userConfig.VelocityWindowMinutes))
+		}
+	}
+
+	return result, nil
+}
+
+func (s Service) accountAgeWithin(ctx context.Context, user models.User, days int) bool {
+	if days <= 0 {
+		return false
+	}
+
+	return user.CreatedAt.After(s.timeService.Now(ctx).AddDate(0, 0, -days))
+}
+
+// Hashes text with case, punctuation and spacing removed so trivially altered
+// copies share a fingerprint, empty text has no fingerprint
+func fingerprint(text string) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			builder.WriteRune(r)
+		}
+	}
+
+	if builder.Len() == 0 {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(builder.String()))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+)
+
+type AuditLogFilter struct {
+	ActorUserId *int64
+	TargetType  *models.AuditTargetType
+	TargetId    *int64
+	From        *time.Time
+	To          *time.Time
+}
+
+func (s Service) CreateAuditLogEntry(ctx context.Context, entry models.AuditLogEntry) (*models.AuditLogEntry, error) {
+	entry.CreatedAt = time.Now()
+
+	result := s.db.WithContext(ctx).Create(&entry)
+	if result.Error != nil {
+		return nil, GeneralDBError{result.Error.Error()}
+	}
+
+	return &entry, nil
+}
+
+// Returns entries newest first, starting after the given cursor when one is
+// provided
+func (s Service) GetAuditLogEntries(ctx context.Context, filter AuditLogFilter, cursor *Cursor, size int) ([]models.AuditLogEntry, error) {
+	var entries []models.AuditLogEntry
+
+	query := s.db.WithContext(ctx).Preload("Actor")
+	if filter.ActorUserId != nil {
+		query = query.Where("actor_user_id = ?", *filter.ActorUserId)
+	}
+	if filter.TargetType != nil {
+		query = query.Where("target_type = ?", *filter.TargetType)
+	}
+	if filter.TargetId != nil {
+		query = query.Where("target_id = ?", *filter.TargetId)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	if cursor != nil {
+		query = query.Where("(created_at, id) < (?, ?)", cursor.Timestamp, cursor.Id)
+	}
+
+	result := query.
+		Order("created_at desc, id desc").
+		Scopes(paginate(s.db, 0, size)).
+		Find(&entries)
+	if result.Error != nil {
+		return nil, GeneralDBError{result.Error.Error()}
+	}
+
+	return entries, nil
+}
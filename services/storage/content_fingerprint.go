@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+)
+
+func (s Service) CreateContentFingerprint(ctx context.Context, userId int64, hash string) (*models.ContentFingerprint, error) {
+	fingerprint := models.ContentFingerprint{
+		UserId:    userId,
+		Hash:      hash,
+		CreatedAt: time.Now(),
+	}
+
+	result := s.db.WithContext(ctx).Create(&fingerprint)
+	if result.Error != nil {
+		return nil, GeneralDBError{result.Error.Error()}
+	}
+
+	return &fingerprint, nil
+}
+
+func (s Service) CountContentFingerprintsByHash(ctx context.Context, hash string, since time.Time) (int64, error) {
+	var count int64
+
+	result := s.db.WithContext(ctx).
+		Model(&models.ContentFingerprint{}).
+		Where("hash = ? AND created_at >= ?", hash, since).
+		Count(&count)
+	if result.Error != nil {
+		return 0, GeneralDBError{result.Error.Error()}
+	}
+
+	return count, nil
+}
+
+func (s Service) CountContentFingerprintsByUserId(ctx context.Context, userId int64, since time.Time) (int64, error) {
+	var count int64
+
+	result := s.db.WithContext(ctx).
+		Model(&models.ContentFingerprint{}).
+		Where("user_id = ? AND created_at >= ?", userId, since).
+		Count(&count)
+	if result.Error != nil {
+		return 0, GeneralDBError{result.Error.Error()}
+	}
+
+	return count, nil
+}
@@ -1,11 +1,15 @@
 package storage
 
-import "github.com/rawfish-dev/angrypros-api/models"
+import (
+	"context"
 
-func (s Service) GetAllCountries() ([]models.Country, error) {
+	"github.com/rawfish-dev/angrypros-api/models"
+)
+
+func (s Service) GetAllCountries(ctx context.Context) ([]models.Country, error) {
 	var countries []models.Country
 
-	result := s.db.Order("name asc").Find(&countries)
+	result := s.db.WithContext(ctx).Order("name asc").Find(&countries)
 	if result.Error != nil {
 		return nil, GeneralDBError{result.Error.Error()}
 	}
@@ -13,6 +17,6 @@ func (s Service) GetAllCountries() ([]models.Country, error) {
 	return countries, nil
 }
 
-func (s Service) GetCountryByIsoAlpha2Code(IsoAlpha2Code string) (*models.Country, error) {
+func (s Service) GetCountryByIsoAlpha2Code(ctx context.Context, IsoAlpha2Code string) (*models.Country, error) {
 	return nil, nil
 }
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm/clause"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+)
+
+// Tokens are unique per device so registering an existing token moves it
+// over to the given user
+func (s Service) RegisterDeviceToken(ctx context.Context, userId int64, token string, platform models.DevicePlatform) (*models.DeviceToken, error) {
+	now := time.Now()
+
+	deviceToken := models.DeviceToken{
+		Token:     token,
+		Platform:  platform,
+		UserId:    userId,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	result := s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "token"}},
+			DoUpdates: clause.AssignmentColumns([]string{"platform", "user_id", "updated_at"}),
+		}).
+		Create(&deviceToken)
+	if result.Error != nil {
+		return nil, GeneralDBError{result.Error.Error()}
+	}
+
+	return &deviceToken, nil
+}
+
+func (s Service) DeleteDeviceToken(ctx context.Context, userId int64, token string) error {
+	result := s.db.WithContext(ctx).
+		Where(models.DeviceToken{UserId: userId, Token: token}).
+		Delete(&models.DeviceToken{})
+	if result.Error != nil {
+		return GeneralDBError{result.Error.Error()}
+	}
+	if result.RowsAffected == 0 {
+		return RecordNotFoundError{}
+	}
+
+	return nil
+}
+
+func (s Service) DeleteDeviceTokens(ctx context.Context, tokens []string) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	result := s.db.WithContext(ctx).
+		Where("token IN ?", tokens).
+		Delete(&models.DeviceToken{})
+	if result.Error != nil {
+		return GeneralDBError{result.Error.Error()}
+	}
+
+	return nil
+}
+
+func (s Service) GetDeviceTokensByUserId(ctx context.Context, userId int64) ([]models.DeviceToken, error) {
+	var deviceTokens []models.DeviceToken
+
+	result := s.db.WithContext(ctx).Find(&deviceTokens, models.DeviceToken{UserId: userId})
+	if result.Error != nil {
+		return nil, GeneralDBError{result.Error.Error()}
+	}
+
+	return deviceTokens, nil
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm/clause"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+)
+
+func (s Service) GetEmailPreference(ctx context.Context, userId int64) (*models.EmailPreference, error) {
+	var preference models.EmailPreference
+
+	result := s.db.WithContext(ctx).Find(&preference, models.EmailPreference{UserId: userId})
+	if result.Error != nil {
+		return nil, GeneralDBError{result.Error.Error()}
+	}
+	if result.RowsAffected == 0 {
+		return nil, RecordNotFoundError{}
+	}
+
+	return &preference, nil
+}
+
+func (s Service) SaveEmailPreference(ctx context.Context, userId int64, digestFrequency models.DigestFrequency) (*models.EmailPreference, error) {
+	now := time.Now()
+
+	preference := models.EmailPreference{
+		UserId:          userId,
+		DigestFrequency: digestFrequency,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+
+	result := s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"digest_frequency", "updated_at"}),
+		}).
+		Create(&preference)
+	if result.Error != nil {
+		return nil, GeneralDBError{result.Error.Error()}
+	}
+
+	return s.GetEmailPreference(ctx, userId)
+}
+
+// Returns users whose effective digest frequency matches, ordered by id so
+// callers can page through with afterUserId. Hidden, shadowbanned,
+// suspended and deleted users are left out
+func (s Service) GetUsersForDigest(ctx context.Context, digestFrequency, defaultDigestFrequency models.DigestFrequency,
+	afterUserId int64, size int) ([]models.User, error) {
+	var users []models.User
+
+	result := s.db.WithContext(ctx).
+		Joins("LEFT JOIN email_preferences ON email_preferences.user_id = users.id").
+		Where("COALESCE(email_preferences.digest_frequency, ?) = ?", defaultDigestFrequency, digestFrequency).
+		Where("users.hidden_at IS NULL AND users.shadowbanned_at IS NULL").
+		Where("users.suspended_until IS NULL OR users.suspended_until <= ?", time.Now()).
+		Where("users.id > ?", afterUserId).
+		Order("users.id asc").
+		Scopes(paginate(s.db, 0, size)).
+		Find(&users)
+	if result.Error != nil {
+		return nil, GeneralDBError{result.Error.Error()}
+	}
+
+	return users, nil
+}
+
+// Claims fail once another run has claimed the period, unless that claim is
+// still pending and was last updated before reclaimPendingBefore, in which
+// case the run that made it is assumed to have died part way
+func (s Service) ClaimEmailDigest(ctx context.Context, userId int64, digestFrequency models.DigestFrequency,
+	periodStart, periodEnd, reclaimPendingBefore time.Time) (*models.EmailDigest, error) {
+	now := time.Now()
+
+	digest := models.EmailDigest{
+		Frequency:   digestFrequency,
+		PeriodStart: periodStart,
+		PeriodEnd:   periodEnd,
+		Status:      models.EmailDigestStatusPending,
+		UserId:      userId,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	result := s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "frequency"}, {Name: "period_start"}},
+			DoUpdates: clause.AssignmentColumns([]string{"period_end", "updated_at"}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				clause.Eq{Column: clause.Column{Table: "email_digests", Name: "status"}, Value: models.EmailDigestStatusPending},
+				clause.Lt{Column: clause.Column{Table: "email_digests", Name: "updated_at"}, Value: reclaimPendingBefore},
+			}},
+		}).
+		Create(&digest)
+	if result.Error != nil {
+		return nil, GeneralDBError{result.Error.Error()}
+	}
+	if result.RowsAffected == 0 {
+		return nil, EmailDigestAlreadyClaimedError{}
+	}
+
+	return &digest, nil
+}
+
+func (s Service) CompleteEmailDigest(ctx context.Context, digestId int64, status models.EmailDigestStatus, notificationCount int) error {
+	result := s.db.WithContext(ctx).
+		Model(&models.EmailDigest{Id: digestId}).
+		Updates(models.EmailDigest{
+			Status:            status,
+			NotificationCount: notificationCount,
+			UpdatedAt:         time.Now(),
+		})
+	if result.Error != nil {
+		return GeneralDBError{result.Error.Error()}
+	}
+
+	return nil
+}
+
+// Releases a claim so the digest is retried on the next run
+func (s Service) DeleteEmailDigest(ctx context.Context, digestId int64) error {
+	result := s.db.WithContext(ctx).Delete(&models.EmailDigest{}, digestId)
+	if result.Error != nil {
+		return GeneralDBError{result.Error.Error()}
+	}
+
+	return nil
+}
@@ -9,12 +9,14 @@ import (
 const (
 	userAlreadyRegisteredErr = "duplicate key value violates unique constraint \"idx_users_firebase_user_id\""
 	countryCodeInvalidErr    = "insert or update on table \"users\" violates foreign key constraint \"fk_users_country\""
+	reportAlreadyExistsErr   = "duplicate key value violates unique constraint \"idx_reports_reporter_target\""
 )
 
 var (
 	knownPartialErrorMessages = []string{
 		userAlreadyRegisteredErr,
 		countryCodeInvalidErr,
+		reportAlreadyExistsErr,
 	}
 )
 
@@ -58,6 +60,42 @@ func (u UserIdInvalidError) Error() string {
 	return "user id is invalid"
 }
 
+type EmailDigestAlreadyClaimedError struct{}
+
+func (e EmailDigestAlreadyClaimedError) Error() string {
+	return "email digest has already been claimed"
+}
+
+type ReportAlreadyExistsError struct{}
+
+func (r ReportAlreadyExistsError) Error() string {
+	return "target has already been reported by this user"
+}
+
+type ReportNotActionableError struct{}
+
+func (r ReportNotActionableError) Error() string {
+	return "report is closed or claimed by another moderator"
+}
+
+type ModerationNotPermittedError struct{}
+
+func (m ModerationNotPermittedError) Error() string {
+	return "moderator may not act against this target"
+}
+
+type ReportTargetTypeInvalidError struct{}
+
+func (r ReportTargetTypeInvalidError) Error() string {
+	return "report target type is invalid"
+}
+
+type ModerationActionInvalidError struct{}
+
+func (m ModerationActionInvalidError) Error() string {
+	return "moderation action is invalid"
+}
+
 func filterConstraintErrors(err error) error {
 	var matchedErrorString string
 
@@ -73,6 +111,8 @@ func filterConstraintErrors(err error) error {
 		return CountryCodeInvalidError{}
 	case userAlreadyRegisteredErr:
 		return UserAlreadyRegisteredError{}
+	case reportAlreadyExistsErr:
+		return ReportAlreadyExistsError{}
 	}
 
 	return nil
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+)
+
+func (s Service) Ping(ctx context.Context) error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return ConnectionError{err.Error()}
+	}
+
+	err = sqlDB.PingContext(ctx)
+	if err != nil {
+		return ConnectionError{err.Error()}
+	}
+
+	return nil
+}
+
+// Verifies everything migrated at startup is present, catching a schema
+// that was dropped or restored from an older backup underneath us
+func (s Service) CheckMigrations(ctx context.Context) error {
+	migrator := s.db.WithContext(ctx).Migrator()
+
+	for _, model := range migratedModels {
+		if !migrator.HasTable(model) {
+			return GeneralDBError{fmt.Sprintf("table for %T is missing", model)}
+		}
+	}
+
+	if !migrator.HasIndex(&models.User{}, "idx_users_normalised_username_trgm") {
+		return GeneralDBError{"username trigram index is missing"}
+	}
+
+	var triggerCount int64
+	result := s.db.WithContext(ctx).
+		Raw("SELECT COUNT(*) FROM pg_trigger WHERE tgname = ?", "audit_log_append_only").
+		Scan(&triggerCount)
+	if result.Error != nil {
+		return GeneralDBError{result.Error.Error()}
+	}
+	if triggerCount == 0 {
+		return GeneralDBError{"audit log append only trigger is missing"}
+	}
+
+	return nil
+}
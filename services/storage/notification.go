@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+)
+
+// Only one unread notification is kept per recipient and target, enforced
+// by idx_notifications_unread_target
+const unreadNotificationPredicate = "read_at IS NULL"
+
+// Inserts the notification or, when an unread one already exists, refreshes
+// it. Either way the row stays locked until the transaction ends so actors
+// are counted without racing concurrent aggregations
+const upsertNotificationQuery = `
+INSERT INTO notifications (type, target_type, target_id, actor_count, recipient_user_id, latest_actor_user_id, created_at, updated_at)
+VALUES (@type, @targetType, @targetId, 1, @recipientUserId, @actorUserId, @now, @now)
+ON CONFLICT (recipient_user_id, type, target_type, target_id) WHERE ` + unreadNotificationPredicate + ` DO UPDATE SET
+	latest_actor_user_id = EXCLUDED.latest_actor_user_id,
+	updated_at = EXCLUDED.updated_at
+RETURNING id`
+
+func (s Service) CreateOrAggregateNotification(ctx context.Context, recipientUserId, actorUserId int64,
+	notificationType models.NotificationType, targetType models.NotificationTargetType,
+	targetId int64) (*models.Notification, error) {
+	now := time.Now()
+
+	var notification models.Notification
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.
+			Raw(upsertNotificationQuery, map[string]interface{}{
+				"type":            notificationType,
+				"targetType":      targetType,
+				"targetId":        targetId,
+				"recipientUserId": recipientUserId,
+				"actorUserId":     actorUserId,
+				"now":             now,
+			}).
+			Scan(&notification)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		// Repeat actions by the same actor refresh the notification without
+		// inflating the actor count
+		result = tx.
+			Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.NotificationActor{
+				NotificationId: notification.Id,
+				ActorUserId:    actorUserId,
+				CreatedAt:      now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected > 0 {
+			result = tx.
+				Model(&models.Notification{Id: notification.Id}).
+				Update("actor_count", tx.
+					Model(&models.NotificationActor{}).
+					Select("COUNT(*)").
+					Where(models.NotificationActor{NotificationId: notification.Id}))
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		return tx.First(&notification, notification.Id).Error
+	})
+	if err != nil {
+		return nil, GeneralDBError{err.Error()}
+	}
+
+	return &notification, nil
+}
+
+// Returns notifications most recently updated first, starting after the
+// given cursor when one is provided
+func (s Service) GetNotifications(ctx context.Context, recipientUserId int64, cursor *Cursor, size int) ([]models.Notification, error) {
+	var notifications []models.Notification
+
+	query := s.db.WithContext(ctx).
+		Preload("LatestActor.Country").
+		Where(models.Notification{RecipientUserId: recipientUserId})
+	if cursor != nil {
+		query = query.Where("(updated_at, id) < (?, ?)", cursor.Timestamp, cursor.Id)
+	}
+
+	result := query.
+		Order("updated_at desc, id desc").
+		Scopes(paginate(s.db, 0, size)).
+		Find(&notifications)
+	if result.Error != nil {
+		return nil, GeneralDBError{result.Error.Error()}
+	}
+
+	return notifications, nil
+}
+
+func (s Service) CountUnreadNotifications(ctx context.Context, recipientUserId int64) (int64, error) {
+	var count int64
+
+	result := s.db.WithContext(ctx).
+		Model(&models.Notification{}).
+		Where(models.Notification{RecipientUserId: recipientUserId}).
+		Where("read_at IS NULL").
+		Count(&count)
+	if result.Error != nil {
+		return 0, GeneralDBError{result.Error.Error()}
+	}
+
+	return count, nil
+}
+
+func (s Service) MarkNotificationRead(ctx context.Context, recipientUserId, notificationId int64) error {
+	now := time.Now()
+
+	result := s.db.WithContext(ctx).
+		Model(&models.Notification{}).
+		Where(models.Notification{Id: notificationId, RecipientUserId: recipientUserId}).
+		UpdateColumn("read_at", gorm.Expr("COALESCE(read_at, ?)", now))
+	if result.Error != nil {
+		return GeneralDBError{result.Error.Error()}
+	}
+	if result.RowsAffected == 0 {
+		return RecordNotFoundError{}
+	}
+
+	return nil
+}
+
+func (s Service) MarkAllNotificationsRead(ctx context.Context, recipientUserId int64) error {
+	now := time.Now()
+
+	result := s.db.WithContext(ctx).
+		Model(&models.Notification{}).
+		Where(models.Notification{RecipientUserId: recipientUserId}).
+		Where("read_at IS NULL").
+		UpdateColumn("read_at", now)
+	if result.Error != nil {
+		return GeneralDBError{result.Error.Error()}
+	}
+
+	return nil
+}
+
+func (s Service) GetNotificationPreferences(ctx context.Context, userId int64) ([]models.NotificationPreference, error) {
+	var preferences []models.NotificationPreference
+
+	result := s.db.WithContext(ctx).Find(&preferences, models.NotificationPreference{UserId: userId})
+	if result.Error != nil {
+		return nil, GeneralDBError{result.Error.Error()}
+	}
+
+	return preferences, nil
+}
+
+func (s Service) SaveNotificationPreferences(ctx context.Context, userId int64, preferences []models.NotificationPreference) ([]models.NotificationPreference, error) {
+	if len(preferences) == 0 {
+		return s.GetNotificationPreferences(ctx, userId)
+	}
+
+	now := time.Now()
+
+	for idx := range preferences {
+		preferences[idx].UserId = userId
+		preferences[idx].CreatedAt = now
+		preferences[idx].UpdatedAt = now
+	}
+
+	result := s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "notification_type"}},
+			DoUpdates: clause.AssignmentColumns([]string{"push_enabled", "updated_at"}),
+		}).
+		Create(&preferences)
+	if result.Error != nil {
+		return nil, GeneralDBError{result.Error.Error()}
+	}
+
+	return s.GetNotificationPreferences(ctx, userId)
+}
+
+func (s Service) GetUnreadNotificationsBetween(ctx context.Context, recipientUserId int64, from, to time.Time, size int) ([]models.Notification, error) {
+	var notifications []models.Notification
+
+	result := s.db.WithContext(ctx).
+		Preload("LatestActor").
+		Where(models.Notification{RecipientUserId: recipientUserId}).
+		Where("read_at IS NULL AND updated_at >= ? AND updated_at < ?", from, to).
+		Order("updated_at desc, id desc").
+		Scopes(paginate(s.db, 0, size)).
+		Find(&notifications)
+	if result.Error != nil {
+		return nil, GeneralDBError{result.Error.Error()}
+	}
+
+	return notifications, nil
+}
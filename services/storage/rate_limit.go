@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+)
+
+// Refills and takes a token from the bucket in a single statement so that
+// concurrent requests across instances cannot overdraw it
+const takeRateLimitTokenQuery = `
+INSERT INTO rate_limit_buckets (key, tokens, allowed, updated_at)
+VALUES (@key, @capacity - 1, true, @now)
+ON CONFLICT (key) DO UPDATE SET
+	tokens = CASE
+		WHEN LEAST(@capacity, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM (@now - rate_limit_buckets.updated_at)) * @rate) >= 1
+		THEN LEAST(@capacity, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM (@now - rate_limit_buckets.updated_at)) * @rate) - 1
+		ELSE LEAST(@capacity, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM (@now - rate_limit_buckets.updated_at)) * @rate)
+	END,
+	allowed = LEAST(@capacity, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM (@now - rate_limit_buckets.updated_at)) * @rate) >= 1,
+	updated_at = @now
+RETURNING key, tokens, allowed, updated_at`
+
+func (s Service) TakeRateLimitToken(ctx context.Context, key string, capacity, refillPerSecond float64, now time.Time) (*models.RateLimitBucket, error) {
+	var bucket models.RateLimitBucket
+
+	result := s.db.WithContext(ctx).
+		Raw(takeRateLimitTokenQuery, map[string]interface{}{
+			"key":      key,
+			"capacity": capacity,
+			"rate":     refillPerSecond,
+			"now":      now,
+		}).
+		Scan(&bucket)
+	if result.Error != nil {
+		return nil, GeneralDBError{result.Error.Error()}
+	}
+
+	return &bucket, nil
+}
+
+// Removes buckets last touched before the given time, returning how many
+// were removed
+func (s Service) DeleteRateLimitBucketsBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).
+		Where("updated_at < ?", before).
+		Delete(&models.RateLimitBucket{})
+	if result.Error != nil {
+		return 0, GeneralDBError{result.Error.Error()}
+	}
+
+	return result.RowsAffected, nil
+}
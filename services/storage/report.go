@@ -0,0 +1,368 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+)
+
+var (
+	activeReportStatuses = []models.ReportStatus{models.ReportStatusOpen, models.ReportStatusClaimed}
+)
+
+// Details a moderator supplies when resolving a report, SuspendedUntil is
+// only relevant to suspensions
+type ReportResolution struct {
+	Action         models.ModerationAction
+	Reason         string
+	SuspendedUntil *time.Time
+}
+
+// Targets are hidden automatically once autoHideThreshold distinct users
+// have active reports against them, a threshold of zero disables this
+func (s Service) CreateReport(ctx context.Context, reporterUserId int64, targetType models.ReportTargetType, targetId int64,
+	reason models.ReportReason, details string, autoHideThreshold int) (*models.Report, error) {
+	now := time.Now()
+
+	report := models.Report{
+		TargetType:     targetType,
+		TargetId:       targetId,
+		Reason:         reason,
+		Details:        details,
+		Status:         models.ReportStatusOpen,
+		ReporterUserId: &reporterUserId,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Create(&report)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if autoHideThreshold <= 0 {
+			return nil
+		}
+
+		var activeReportCount int64
+		result = tx.
+			Model(&models.Report{}).
+			Where(models.Report{TargetType: targetType, TargetId: targetId}).
+			Where("status IN ? AND reporter_user_id IS NOT NULL", activeReportStatuses).
+			Count(&activeReportCount)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if activeReportCount < int64(autoHideThreshold) {
+			return nil
+		}
+
+		return hideReportTarget(tx, targetType, targetId, now)
+	})
+	if err != nil {
+		constraintError := filterConstraintErrors(err)
+		if constraintError != nil {
+			return nil, constraintError
+		}
+
+		return nil, GeneralDBError{err.Error()}
+	}
+
+	return &report, nil
+}
+
+// Only one automated report is kept active per target, enforced by
+// idx_reports_active_automated_target
+const activeAutomatedReportPredicate = "reporter_user_id IS NULL AND status IN ('open', 'claimed')"
+
+// Further findings against a target with an active automated report are
+// appended to its details instead of raising another report, repeated
+// findings are only recorded once
+const createAutomatedReportQuery = `
+INSERT INTO reports (target_type, target_id, reason, details, status, created_at, updated_at)
+VALUES (@targetType, @targetId, @reason, @details, @status, @now, @now)
+ON CONFLICT (target_type, target_id) WHERE ` + activeAutomatedReportPredicate + ` DO UPDATE SET
+	details = CASE
+		WHEN POSITION(EXCLUDED.details IN reports.details) > 0 THEN reports.details
+		ELSE reports.details || E'\n' || EXCLUDED.details
+	END,
+	updated_at = EXCLUDED.updated_at
+RETURNING *`
+
+// Raised by the system, for example when screening flags content, these do
+// not count towards automatic hiding
+func (s Service) CreateAutomatedReport(ctx context.Context, targetType models.ReportTargetType, targetId int64,
+	details string) (*models.Report, error) {
+	var report models.Report
+
+	result := s.db.WithContext(ctx).
+		Raw(createAutomatedReportQuery, map[string]interface{}{
+			"targetType": targetType,
+			"targetId":   targetId,
+			"reason":     models.ReportReasonAutomated,
+			"details":    details,
+			"status":     models.ReportStatusOpen,
+			"now":        time.Now(),
+		}).
+		Scan(&report)
+	if result.Error != nil {
+		return nil, GeneralDBError{result.Error.Error()}
+	}
+
+	return &report, nil
+}
+
+// Returns reports oldest first so the queue is worked in order, starting
+// after the given cursor when one is provided
+func (s Service) GetReports(ctx context.Context, status *models.ReportStatus, cursor *Cursor, size int) ([]models.Report, error) {
+	var reports []models.Report
+
+	query := s.db.WithContext(ctx).
+		Preload("Reporter").
+		Preload("Moderator")
+	if status != nil {
+		query = query.Where(models.Report{Status: *status})
+	}
+	if cursor != nil {
+		query = query.Where("(created_at, id) > (?, ?)", cursor.Timestamp, cursor.Id)
+	}
+
+	result := query.
+		Order("created_at asc, id asc").
+		Scopes(paginate(s.db, 0, size)).
+		Find(&reports)
+	if result.Error != nil {
+		return nil, GeneralDBError{result.Error.Error()}
+	}
+
+	return reports, nil
+}
+
+func (s Service) GetReportById(ctx context.Context, reportId int64) (*models.Report, error) {
+	var report models.Report
+
+	result := s.db.WithContext(ctx).
+		Preload("Reporter").
+		Preload("Moderator").
+		Find(&report, models.Report{Id: reportId})
+	if result.Error != nil {
+		return nil, GeneralDBError{result.Error.Error()}
+	}
+	if result.RowsAffected == 0 {
+		return nil, RecordNotFoundError{}
+	}
+
+	return &report, nil
+}
+
+func (s Service) ClaimReport(ctx context.Context, reportId, moderatorUserId int64) (*models.Report, error) {
+	now := time.Now()
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		_, err := lockActionableReport(tx, reportId, moderatorUserId)
+		if err != nil {
+			return err
+		}
+
+		return tx.
+			Model(&models.Report{Id: reportId}).
+			Updates(map[string]interface{}{
+				"status":            models.ReportStatusClaimed,
+				"moderator_user_id": moderatorUserId,
+				"claimed_at":        now,
+				"updated_at":        now,
+			}).Error
+	})
+	if err != nil {
+		return nil, wrapReportError(err)
+	}
+
+	return s.GetReportById(ctx, reportId)
+}
+
+// Applies the resolution action to the target and closes every active
+// report against that target, all within a single transaction
+func (s Service) ResolveReport(ctx context.Context, reportId, moderatorUserId int64, resolution ReportResolution) (*models.Report, error) {
+	now := time.Now()
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		report, err := lockActionableReport(tx, reportId, moderatorUserId)
+		if err != nil {
+			return err
+		}
+
+		err = checkCanModerateTarget(tx, *report, moderatorUserId)
+		if err != nil {
+			return err
+		}
+
+		err = applyModerationAction(tx, *report, moderatorUserId, resolution, now)
+		if err != nil {
+			return err
+		}
+
+		return tx.
+			Model(&models.Report{}).
+			Where(models.Report{TargetType: report.TargetType, TargetId: report.TargetId}).
+			Where("status IN ?", activeReportStatuses).
+			Updates(map[string]interface{}{
+				"status":            models.ReportStatusResolved,
+				"resolution_action": resolution.Action,
+				"moderator_user_id": moderatorUserId,
+				"closed_at":         now,
+				"updated_at":        now,
+			}).Error
+	})
+	if err != nil {
+		return nil, wrapReportError(err)
+	}
+
+	return s.GetReportById(ctx, reportId)
+}
+
+func (s Service) DismissReport(ctx context.Context, reportId, moderatorUserId int64) (*models.Report, error) {
+	now := time.Now()
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		_, err := lockActionableReport(tx, reportId, moderatorUserId)
+		if err != nil {
+			return err
+		}
+
+		return tx.
+			Model(&models.Report{Id: reportId}).
+			Updates(map[string]interface{}{
+				"status":            models.ReportStatusDismissed,
+				"moderator_user_id": moderatorUserId,
+				"closed_at":         now,
+				"updated_at":        now,
+			}).Error
+	})
+	if err != nil {
+		return nil, wrapReportError(err)
+	}
+
+	return s.GetReportById(ctx, reportId)
+}
+
+// A report can be acted on when it is open or already claimed by the same
+// moderator
+func lockActionableReport(tx *gorm.DB, reportId, moderatorUserId int64) (*models.Report, error) {
+	var report models.Report
+
+	result := tx.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Find(&report, models.Report{Id: reportId})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, RecordNotFoundError{}
+	}
+
+	switch report.Status {
+	case models.ReportStatusOpen:
+		return &report, nil
+	case models.ReportStatusClaimed:
+		if report.ModeratorUserId != nil && *report.ModeratorUserId == moderatorUserId {
+			return &report, nil
+		}
+	}
+
+	return nil, ReportNotActionableError{}
+}
+
+// Enforced here as well as by handlers so resolving a report cannot be used
+// to act against the moderator themselves or someone of equal or higher role
+func checkCanModerateTarget(tx *gorm.DB, report models.Report, moderatorUserId int64) error {
+	if report.TargetType != models.ReportTargetTypeUser {
+		return nil
+	}
+
+	var users []models.User
+	result := tx.
+		Preload("Roles").
+		Where("id IN ?", []int64{moderatorUserId, report.TargetId}).
+		Find(&users)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	var moderator, target *models.User
+	for idx := range users {
+		if users[idx].Id == moderatorUserId {
+			moderator = &users[idx]
+		}
+		if users[idx].Id == report.TargetId {
+			target = &users[idx]
+		}
+	}
+	if target == nil {
+		return RecordNotFoundError{}
+	}
+	if moderator == nil || !moderator.CanModerate(*target) {
+		return ModerationNotPermittedError{}
+	}
+
+	return nil
+}
+
+func hideReportTarget(tx *gorm.DB, targetType models.ReportTargetType, targetId int64, now time.Time) error {
+	switch targetType {
+	case models.ReportTargetTypeUser:
+		return tx.
+			Model(&models.User{Id: targetId}).
+			Where("hidden_at IS NULL").
+			UpdateColumn("hidden_at", now).Error
+	}
+
+	return ReportTargetTypeInvalidError{}
+}
+
+func applyModerationAction(tx *gorm.DB, report models.Report, moderatorUserId int64,
+	resolution ReportResolution, now time.Time) error {
+	if report.TargetType != models.ReportTargetTypeUser {
+		return ReportTargetTypeInvalidError{}
+	}
+
+	switch resolution.Action {
+	case models.ModerationActionHide:
+		return hideReportTarget(tx, report.TargetType, report.TargetId, now)
+
+	case models.ModerationActionDelete:
+		return tx.Delete(&models.User{Id: report.TargetId}).Error
+
+	case models.ModerationActionWarn:
+		return tx.Create(&models.UserWarning{
+			Reason:          resolution.Reason,
+			UserId:          report.TargetId,
+			ModeratorUserId: moderatorUserId,
+			ReportId:        &report.Id,
+			CreatedAt:       now,
+		}).Error
+
+	case models.ModerationActionSuspend:
+		return suspendUser(tx, report.TargetId, *resolution.SuspendedUntil, resolution.Reason, now)
+
+	case models.ModerationActionShadowban:
+		return shadowbanUser(tx, report.TargetId, &now, now)
+	}
+
+	return ModerationActionInvalidError{}
+}
+
+func wrapReportError(err error) error {
+	switch err.(type) {
+	case RecordNotFoundError, ReportNotActionableError, ModerationNotPermittedError,
+		ReportTargetTypeInvalidError, ModerationActionInvalidError:
+		return err
+	}
+
+	return GeneralDBError{err.Error()}
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/rawfish-dev/angrypros-api/models"
+)
+
+// Replaces all roles held by the user with the given roles
+func (s Service) SetUserRoles(ctx context.Context, userId int64, roles []models.Role) (*models.User, error) {
+	now := time.Now()
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.
+			Where(models.UserRole{UserId: userId}).
+			Delete(&models.UserRole{})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if len(roles) == 0 {
+			return nil
+		}
+
+		userRoles := make([]models.UserRole, len(roles))
+		for idx := range roles {
+			userRoles[idx] = models.UserRole{
+				UserId:    userId,
+				Role:      roles[idx],
+				CreatedAt: now,
+			}
+		}
+
+		return tx.Create(&userRoles).Error
+	})
+	if err != nil {
+		return nil, GeneralDBError{err.Error()}
+	}
+
+	return s.GetUserById(ctx, userId)
+}
+
+func (s Service) CountUsersWithRole(ctx context.Context, role models.Role) (int64, error) {
+	var count int64
+
+	result := s.db.WithContext(ctx).
+		Model(&models.UserRole{}).
+		Where(models.UserRole{Role: role}).
+		Count(&count)
+	if result.Error != nil {
+		return 0, GeneralDBError{result.Error.Error()}
+	}
+
+	return count, nil
+}
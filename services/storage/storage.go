@@ -1,7 +1,10 @@
 package storage
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -17,32 +20,133 @@ const (
 var _ StorageService = new(Service)
 
 type StorageService interface {
+	// Runs fn against a storage service bound to a single transaction which
+	// is committed only if fn returns no error
+	Transaction(ctx context.Context, fn func(tx StorageService) error) error
+
 	UserStorage
 	CountryStorage
 	EntryStorage
+	NotificationStorage
+	DeviceStorage
+	EmailStorage
+	ReportStorage
+	RoleStorage
+	AuditStorage
+	RateLimitStorage
+	ContentFingerprintStorage
+	HealthStorage
+}
+
+type HealthStorage interface {
+	Ping(ctx context.Context) error
+	CheckMigrations(ctx context.Context) error
 }
 
 type UserStorage interface {
-	CreateUser(firebaseUserId, username, emailAddress, countryIsoAlpha2Code string) (*models.User, error)
-	EditUser(user models.User, username, countryIsoAlpha2Code string) (*models.User, error)
-	GetUserById(userId int64) (*models.User, error)
-	GetUserByFirebaseUserId(firebaseUserId string) (*models.User, error)
-	GetUserByEmailAddress(emailAddress string) (*models.User, error)
+	CreateUser(ctx context.Context, firebaseUserId, username, emailAddress, countryIsoAlpha2Code string) (*models.User, error)
+	EditUser(ctx context.Context, user models.User, username, countryIsoAlpha2Code string) (*models.User, error)
+	GetUserById(ctx context.Context, userId int64) (*models.User, error)
+	GetUserByFirebaseUserId(ctx context.Context, firebaseUserId string) (*models.User, error)
+	GetUserByEmailAddress(ctx context.Context, emailAddress string) (*models.User, error)
+	SearchUsers(ctx context.Context, query string, limit int) ([]models.User, error)
+	SuspendUser(ctx context.Context, userId int64, suspendedUntil time.Time, reason string) (*models.User, error)
+	UnsuspendUser(ctx context.Context, userId int64) (*models.User, error)
+	SetUserShadowbanned(ctx context.Context, userId int64, shadowbanned bool) (*models.User, error)
 }
 
 type CountryStorage interface {
-	GetAllCountries() ([]models.Country, error)
-	GetCountryByIsoAlpha2Code(isoAlpha2Code string) (*models.Country, error)
+	GetAllCountries(ctx context.Context) ([]models.Country, error)
+	GetCountryByIsoAlpha2Code(ctx context.Context, isoAlpha2Code string) (*models.Country, error)
 }
 
 type EntryStorage interface {
 }
 
+type NotificationStorage interface {
+	CreateOrAggregateNotification(ctx context.Context, recipientUserId, actorUserId int64,
+		notificationType models.NotificationType, targetType models.NotificationTargetType,
+		targetId int64) (*models.Notification, error)
+	GetNotifications(ctx context.Context, recipientUserId int64, cursor *Cursor, size int) ([]models.Notification, error)
+	CountUnreadNotifications(ctx context.Context, recipientUserId int64) (int64, error)
+	MarkNotificationRead(ctx context.Context, recipientUserId, notificationId int64) error
+	MarkAllNotificationsRead(ctx context.Context, recipientUserId int64) error
+	GetNotificationPreferences(ctx context.Context, userId int64) ([]models.NotificationPreference, error)
+	SaveNotificationPreferences(ctx context.Context, userId int64, preferences []models.NotificationPreference) ([]models.NotificationPreference, error)
+	GetUnreadNotificationsBetween(ctx context.Context, recipientUserId int64, from, to time.Time, size int) ([]models.Notification, error)
+}
+
+type DeviceStorage interface {
+	RegisterDeviceToken(ctx context.Context, userId int64, token string, platform models.DevicePlatform) (*models.DeviceToken, error)
+	DeleteDeviceToken(ctx context.Context, userId int64, token string) error
+	DeleteDeviceTokens(ctx context.Context, tokens []string) error
+	GetDeviceTokensByUserId(ctx context.Context, userId int64) ([]models.DeviceToken, error)
+}
+
+type EmailStorage interface {
+	GetEmailPreference(ctx context.Context, userId int64) (*models.EmailPreference, error)
+	SaveEmailPreference(ctx context.Context, userId int64, digestFrequency models.DigestFrequency) (*models.EmailPreference, error)
+	GetUsersForDigest(ctx context.Context, digestFrequency, defaultDigestFrequency models.DigestFrequency,
+		afterUserId int64, size int) ([]models.User, error)
+	ClaimEmailDigest(ctx context.Context, userId int64, digestFrequency models.DigestFrequency,
+		periodStart, periodEnd, reclaimPendingBefore time.Time) (*models.EmailDigest, error)
+	CompleteEmailDigest(ctx context.Context, digestId int64, status models.EmailDigestStatus, notificationCount int) error
+	DeleteEmailDigest(ctx context.Context, digestId int64) error
+}
+
+type RoleStorage interface {
+	SetUserRoles(ctx context.Context, userId int64, roles []models.Role) (*models.User, error)
+	CountUsersWithRole(ctx context.Context, role models.Role) (int64, error)
+}
+
+type AuditStorage interface {
+	CreateAuditLogEntry(ctx context.Context, entry models.AuditLogEntry) (*models.AuditLogEntry, error)
+	GetAuditLogEntries(ctx context.Context, filter AuditLogFilter, cursor *Cursor, size int) ([]models.AuditLogEntry, error)
+}
+
+type RateLimitStorage interface {
+	TakeRateLimitToken(ctx context.Context, key string, capacity, refillPerSecond float64, now time.Time) (*models.RateLimitBucket, error)
+	DeleteRateLimitBucketsBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type ContentFingerprintStorage interface {
+	CreateContentFingerprint(ctx context.Context, userId int64, hash string) (*models.ContentFingerprint, error)
+	CountContentFingerprintsByHash(ctx context.Context, hash string, since time.Time) (int64, error)
+	CountContentFingerprintsByUserId(ctx context.Context, userId int64, since time.Time) (int64, error)
+}
+
+type ReportStorage interface {
+	CreateReport(ctx context.Context, reporterUserId int64, targetType models.ReportTargetType, targetId int64,
+		reason models.ReportReason, details string, autoHideThreshold int) (*models.Report, error)
+	CreateAutomatedReport(ctx context.Context, targetType models.ReportTargetType, targetId int64, details string) (*models.Report, error)
+	GetReports(ctx context.Context, status *models.ReportStatus, cursor *Cursor, size int) ([]models.Report, error)
+	GetReportById(ctx context.Context, reportId int64) (*models.Report, error)
+	ClaimReport(ctx context.Context, reportId, moderatorUserId int64) (*models.Report, error)
+	ResolveReport(ctx context.Context, reportId, moderatorUserId int64, resolution ReportResolution) (*models.Report, error)
+	DismissReport(ctx context.Context, reportId, moderatorUserId int64) (*models.Report, error)
+}
+
+// Keyset position used for cursor pagination over time ordered records
+type Cursor struct {
+	Timestamp time.Time
+	Id        int64
+}
+
 type Service struct {
 	db *gorm.DB
 }
 
-func NewService(p config.PostgresConfig) (*Service, error) {
+var (
+	migratedModels = []interface{}{&models.User{}, &models.Country{},
+		&models.Notification{}, &models.NotificationActor{}, &models.NotificationPreference{},
+		&models.DeviceToken{}, &models.EmailPreference{}, &models.EmailDigest{},
+		&models.Report{}, &models.UserWarning{}, &models.UserRole{},
+		&models.AuditLogEntry{}, &models.RateLimitBucket{},
+		&models.ContentFingerprint{}}
+)
+
+// Plugins such as metrics are registered before migrations run
+func NewService(p config.PostgresConfig, plugins ...gorm.Plugin) (*Service, error) {
 	connectionStr := fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		p.Host, p.Port, p.Username, p.Password, p.Database, p.SSLMode)
@@ -60,16 +164,139 @@ func NewService(p config.PostgresConfig) (*Service, error) {
 		return nil, ConnectionError{err.Error()}
 	}
 
-	err = db.AutoMigrate(&models.User{}, &models.Country{})
+	for _, plugin := range plugins {
+		err = db.Use(plugin)
+		if err != nil {
+			return nil, GeneralDBError{fmt.Sprintf("could not register %s plugin due to %s", plugin.Name(), err)}
+		}
+	}
+
+	err = db.AutoMigrate(migratedModels...)
 	if err != nil {
 		return nil, GeneralDBError{fmt.Sprintf("could not auto migrate due to %s", err)}
 	}
 
+	err = migrateSearchIndexes(db)
+	if err != nil {
+		return nil, GeneralDBError{fmt.Sprintf("could not migrate search indexes due to %s", err)}
+	}
+
+	err = migrateActiveAutomatedReportIndex(db)
+	if err != nil {
+		return nil, GeneralDBError{fmt.Sprintf("could not migrate active automated report index due to %s", err)}
+	}
+
+	err = migrateUnreadNotificationIndex(db)
+	if err != nil {
+		return nil, GeneralDBError{fmt.Sprintf("could not migrate unread notification index due to %s", err)}
+	}
+
+	err = migrateAuditLogTrigger(db)
+	if err != nil {
+		return nil, GeneralDBError{fmt.Sprintf("could not migrate audit log trigger due to %s", err)}
+	}
+
 	return &Service{
 		db: db,
 	}, nil
 }
 
+// Exposes the connection pool, for example to report its statistics
+func (s Service) SQLDB() (*sql.DB, error) {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return nil, ConnectionError{err.Error()}
+	}
+
+	return sqlDB, nil
+}
+
+// Closes the underlying connection pool, the service cannot be used after
+func (s Service) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return ConnectionError{err.Error()}
+	}
+
+	err = sqlDB.Close()
+	if err != nil {
+		return ConnectionError{err.Error()}
+	}
+
+	return nil
+}
+
+// Indexes which AutoMigrate is unable to express through struct tags
+func migrateSearchIndexes(db *gorm.DB) error {
+	err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error
+	if err != nil {
+		return err
+	}
+
+	// Serves both prefix LIKE and trigram similarity matching on usernames
+	return db.Exec("CREATE INDEX IF NOT EXISTS idx_users_normalised_username_trgm " +
+		"ON users USING gin (normalised_username gin_trgm_ops)").Error
+}
+
+// Partial unique index allowing a single active automated report per target.
+// Duplicates raised before the index existed are dismissed first, keeping
+// the oldest so any claim on it is likely preserved
+func migrateActiveAutomatedReportIndex(db *gorm.DB) error {
+	err := db.Exec(`UPDATE reports SET status = ?, closed_at = NOW(), updated_at = NOW()
+		WHERE `+activeAutomatedReportPredicate+` AND id NOT IN (
+			SELECT MIN(id) FROM reports WHERE `+activeAutomatedReportPredicate+`
+			GROUP BY target_type, target_id)`, models.ReportStatusDismissed).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_reports_active_automated_target " +
+		"ON reports (target_type, target_id) WHERE " + activeAutomatedReportPredicate).Error
+}
+
+// Partial unique index allowing a single unread notification per recipient
+// and target. Duplicates created before the index existed are marked read,
+// keeping the newest unread
+func migrateUnreadNotificationIndex(db *gorm.DB) error {
+	err := db.Exec(`UPDATE notifications SET read_at = NOW()
+		WHERE ` + unreadNotificationPredicate + ` AND id NOT IN (
+			SELECT MAX(id) FROM notifications WHERE ` + unreadNotificationPredicate + `
+			GROUP BY recipient_user_id, type, target_type, target_id)`).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_unread_target " +
+		"ON notifications (recipient_user_id, type, target_type, target_id) WHERE " + unreadNotificationPredicate).Error
+}
+
+// Enforces the audit log being append only regardless of which client is
+// connected to the database
+func migrateAuditLogTrigger(db *gorm.DB) error {
+	err := db.Exec(`CREATE OR REPLACE FUNCTION prevent_audit_log_mutation() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_log is append only';
+		END;
+		$$ LANGUAGE plpgsql`).Error
+	if err != nil {
+		return err
+	}
+
+	err = db.Exec("DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log").Error
+	if err != nil {
+		return err
+	}
+
+	return db.Exec("CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log " +
+		"FOR EACH ROW EXECUTE FUNCTION prevent_audit_log_mutation()").Error
+}
+
+func (s Service) Transaction(ctx context.Context, fn func(tx StorageService) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(Service{db: tx})
+	})
+}
+
 func paginate(db *gorm.DB, offset, size int) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		if offset < 0 {
@@ -1,13 +1,21 @@
 package storage
 
 import (
+	"context"
 	"strings"
 	"time"
 
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
 	"github.com/rawfish-dev/angrypros-api/models"
 )
 
-func (s Service) CreateUser(firebaseUserId, username, emailAddress, countryIsoAlpha2Code string) (*models.User, error) {
+var (
+	likePatternEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+)
+
+func (s Service) CreateUser(ctx context.Context, firebaseUserId, username, emailAddress, countryIsoAlpha2Code string) (*models.User, error) {
 	now := time.Now()
 
 	newUser := models.User{
@@ -20,7 +28,7 @@ func (s Service) CreateUser(firebaseUserId, username, emailAddress, countryIsoAl
 		UpdatedAt:              now,
 	}
 
-	result := s.db.Create(&newUser)
+	result := s.db.WithContext(ctx).Create(&newUser)
 	if result.Error != nil {
 		constraintError := filterConstraintErrors(result.Error)
 		if constraintError != nil {
@@ -30,10 +38,10 @@ func (s Service) CreateUser(firebaseUserId, username, emailAddress, countryIsoAl
 		return nil, GeneralDBError{result.Error.Error()}
 	}
 
-	return s.GetUserById(newUser.Id)
+	return s.GetUserById(ctx, newUser.Id)
 }
 
-func (s Service) EditUser(user models.User, username, countryIsoAlpha2Code string) (*models.User, error) {
+func (s Service) EditUser(ctx context.Context, user models.User, username, countryIsoAlpha2Code string) (*models.User, error) {
 	now := time.Now()
 
 	editedUser := models.User{
@@ -43,7 +51,7 @@ func (s Service) EditUser(user models.User, username, countryIsoAlpha2Code strin
 		UpdatedAt:            now,
 	}
 
-	result := s.db.Model(&user).Updates(editedUser)
+	result := s.db.WithContext(ctx).Model(&user).Updates(editedUser)
 	if result.Error != nil {
 		constraintError := filterConstraintErrors(result.Error)
 		if constraintError != nil {
@@ -53,14 +61,15 @@ func (s Service) EditUser(user models.User, username, countryIsoAlpha2Code strin
 		return nil, GeneralDBError{result.Error.Error()}
 	}
 
-	return s.GetUserById(user.Id)
+	return s.GetUserById(ctx, user.Id)
 }
 
-func (s Service) GetUserById(userId int64) (*models.User, error) {
+func (s Service) GetUserById(ctx context.Context, userId int64) (*models.User, error) {
 	var user models.User
 
-	result := s.db.
+	result := s.db.WithContext(ctx).
 		Joins("Country").
+		Preload("Roles").
 		Find(&user, models.User{Id: userId})
 	if result.Error != nil {
 		return nil, GeneralDBError{result.Error.Error()}
@@ -72,11 +81,12 @@ func (s Service) GetUserById(userId int64) (*models.User, error) {
 	return &user, nil
 }
 
-func (s Service) GetUserByFirebaseUserId(firebaseUserId string) (*models.User, error) {
+func (s Service) GetUserByFirebaseUserId(ctx context.Context, firebaseUserId string) (*models.User, error) {
 	var user models.User
 
-	result := s.db.
+	result := s.db.WithContext(ctx).
 		Joins("Country").
+		Preload("Roles").
 		Find(&user, models.User{FirebaseUserId: firebaseUserId})
 	if result.Error != nil {
 		return nil, GeneralDBError{result.Error.Error()}
@@ -88,10 +98,10 @@ func (s Service) GetUserByFirebaseUserId(firebaseUserId string) (*models.User, e
 	return &user, nil
 }
 
-func (s Service) GetUserByEmailAddress(emailAddress string) (*models.User, error) {
+func (s Service) GetUserByEmailAddress(ctx context.Context, emailAddress string) (*models.User, error) {
 	var user models.User
 
-	result := s.db.Find(&user, models.User{NormalisedEmailAddress: strings.ToLower(emailAddress)})
+	result := s.db.WithContext(ctx).Find(&user, models.User{NormalisedEmailAddress: strings.ToLower(emailAddress)})
 	if result.Error != nil {
 		return nil, GeneralDBError{result.Error.Error()}
 	}
@@ -101,3 +111,98 @@ func (s Service) GetUserByEmailAddress(emailAddress string) (*models.User, error
 
 	return &user, nil
 }
+
+// Matches usernames by prefix first and then by trigram similarity, expects
+// query to already be normalised
+func (s Service) SearchUsers(ctx context.Context, query string, limit int) ([]models.User, error) {
+	var users []models.User
+
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+
+	prefixPattern := escapeLikePattern(query) + "%"
+
+	result := s.db.WithContext(ctx).
+		Joins("Country").
+		Where("users.normalised_username LIKE ? OR users.normalised_username % ?", prefixPattern, query).
+		Where("users.hidden_at IS NULL AND users.shadowbanned_at IS NULL").
+		Order(clause.Expr{
+			SQL: "users.normalised_username LIKE ? DESC, " +
+				"similarity(users.normalised_username, ?) DESC, users.normalised_username ASC",
+			Vars:               []interface{}{prefixPattern, query},
+			WithoutParentheses: true,
+		}).
+		Limit(limit).
+		Find(&users)
+	if result.Error != nil {
+		return nil, GeneralDBError{result.Error.Error()}
+	}
+
+	return users, nil
+}
+
+func (s Service) SuspendUser(ctx context.Context, userId int64, suspendedUntil time.Time, reason string) (*models.User, error) {
+	err := suspendUser(s.db.WithContext(ctx), userId, suspendedUntil, reason, time.Now())
+	if err != nil {
+		return nil, GeneralDBError{err.Error()}
+	}
+
+	return s.GetUserById(ctx, userId)
+}
+
+func (s Service) UnsuspendUser(ctx context.Context, userId int64) (*models.User, error) {
+	result := s.db.WithContext(ctx).
+		Model(&models.User{Id: userId}).
+		Updates(map[string]interface{}{
+			"suspended_until":   nil,
+			"suspension_reason": "",
+			"updated_at":        time.Now(),
+		})
+	if result.Error != nil {
+		return nil, GeneralDBError{result.Error.Error()}
+	}
+
+	return s.GetUserById(ctx, userId)
+}
+
+// Shadowbanned users can still use the app but nobody else sees them or
+// their content
+func (s Service) SetUserShadowbanned(ctx context.Context, userId int64, shadowbanned bool) (*models.User, error) {
+	now := time.Now()
+
+	var shadowbannedAt *time.Time
+	if shadowbanned {
+		shadowbannedAt = &now
+	}
+
+	err := shadowbanUser(s.db.WithContext(ctx), userId, shadowbannedAt, now)
+	if err != nil {
+		return nil, GeneralDBError{err.Error()}
+	}
+
+	return s.GetUserById(ctx, userId)
+}
+
+func suspendUser(db *gorm.DB, userId int64, suspendedUntil time.Time, reason string, now time.Time) error {
+	return db.
+		Model(&models.User{Id: userId}).
+		Updates(map[string]interface{}{
+			"suspended_until":   suspendedUntil,
+			"suspension_reason": reason,
+			"updated_at":        now,
+		}).Error
+}
+
+func shadowbanUser(db *gorm.DB, userId int64, shadowbannedAt *time.Time, now time.Time) error {
+	return db.
+		Model(&models.User{Id: userId}).
+		Updates(map[string]interface{}{
+			"shadowbanned_at": shadowbannedAt,
+			"updated_at":      now,
+		}).Error
+}
+
+func escapeLikePattern(value string) string {
+	return likePatternEscaper.Replace(value)
+}
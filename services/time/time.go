@@ -1,13 +1,19 @@
 package time
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // A service that exists only to wrap time utilities for easy test mocking
 
 var _ TimeService = new(Service)
 
 type TimeService interface {
-	Now() time.Time
+	Now(ctx context.Context) time.Time
+	// Never fires if ctx is done first, so callers should also select on
+	// ctx.Done()
+	After(ctx context.Context, d time.Duration) <-chan time.Time
 }
 
 type Service struct{}
@@ -16,6 +22,23 @@ func NewService() *Service {
 	return &Service{}
 }
 
-func (s Service) Now() time.Time {
+func (s Service) Now(ctx context.Context) time.Time {
 	return time.Now()
 }
+
+func (s Service) After(ctx context.Context, d time.Duration) <-chan time.Time {
+	fired := make(chan time.Time, 1)
+
+	timer := time.NewTimer(d)
+	go func() {
+		defer timer.Stop()
+
+		select {
+		case t := <-timer.C:
+			fired <- t
+		case <-ctx.Done():
+		}
+	}()
+
+	return fired
+}
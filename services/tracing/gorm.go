@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const (
+	gormPluginName     = "tracing"
+	gormSpanKey        = "tracing:span"
+	gormCallbackBefore = "tracing:before_"
+	gormCallbackAfter  = "tracing:after_"
+	gormTracerName     = "github.com/rawfish-dev/angrypros-api/services/storage"
+)
+
+var _ gorm.Plugin = new(GormPlugin)
+
+// Creates a client span for every GORM operation as a child of the span in
+// the statement's context, so queries only join a trace when the caller
+// passed its context through WithContext
+type GormPlugin struct {
+	tracer trace.Tracer
+}
+
+func NewGormPlugin() *GormPlugin {
+	return &GormPlugin{
+		tracer: otel.Tracer(gormTracerName),
+	}
+}
+
+func (p GormPlugin) Name() string {
+	return gormPluginName
+}
+
+func (p GormPlugin) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+
+	registrations := []struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", callback.Create().Before("gorm:create").Register, callback.Create().After("gorm:create").Register},
+		{"query", callback.Query().Before("gorm:query").Register, callback.Query().After("gorm:query").Register},
+		{"update", callback.Update().Before("gorm:update").Register, callback.Update().After("gorm:update").Register},
+		{"delete", callback.Delete().Before("gorm:delete").Register, callback.Delete().After("gorm:delete").Register},
+		{"row", callback.Row().Before("gorm:row").Register, callback.Row().After("gorm:row").Register},
+		{"raw", callback.Raw().Before("gorm:raw").Register, callback.Raw().After("gorm:raw").Register},
+	}
+
+	for _, registration := range registrations {
+		err := registration.before(gormCallbackBefore+registration.operation, p.before(registration.operation))
+		if err != nil {
+			return err
+		}
+
+		err = registration.after(gormCallbackAfter+registration.operation, p.after)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p GormPlugin) before(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		_, span := p.tracer.Start(db.Statement.Context, "db."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationName(operation)))
+
+		db.InstanceSet(gormSpanKey, span)
+	}
+}
+
+func (p GormPlugin) after(db *gorm.DB) {
+	value, exists := db.InstanceGet(gormSpanKey)
+	if !exists {
+		return
+	}
+
+	span := value.(trace.Span)
+	defer span.End()
+
+	if len(db.Statement.Table) != 0 {
+		span.SetAttributes(semconv.DBCollectionName(db.Statement.Table))
+	}
+	// Statements are parameterised so no values are recorded
+	span.SetAttributes(semconv.DBQueryText(db.Statement.SQL.String()))
+
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
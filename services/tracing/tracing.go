@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"github.com/rawfish-dev/angrypros-api/config"
+)
+
+// Configures the global OpenTelemetry tracer provider, instrumented code
+// only ever uses otel.Tracer so it records nothing until an exporter is set
+
+const (
+	ExporterNone = "none"
+	ExporterOTLP = "otlp"
+
+	defaultServiceName = "angrypros-api"
+)
+
+// Flushes any buffered spans, safe to call when tracing is disabled
+type ShutdownFunc func(ctx context.Context) error
+
+func Setup(tc config.TracingConfig) (ShutdownFunc, error) {
+	// Incoming trace context is honoured even when not exporting so ids
+	// still flow through to anything called downstream
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	switch tc.Exporter {
+	case "", ExporterNone:
+		return func(ctx context.Context) error { return nil }, nil
+	case ExporterOTLP:
+	default:
+		return nil, fmt.Errorf("tracing exporter '%s' is unknown", tc.Exporter)
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(tc.Endpoint),
+	}
+	if tc.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("could not create otlp exporter due to %s", err)
+	}
+
+	serviceName := tc.ServiceName
+	if len(serviceName) == 0 {
+		serviceName = defaultServiceName
+	}
+
+	// Zero is passed through so it never samples
+	sampleRatio := 1.0
+	if tc.SampleRatio != nil {
+		sampleRatio = *tc.SampleRatio
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+	otel.SetTracerProvider(tracerProvider)
+
+	return tracerProvider.Shutdown, nil
+}